@@ -0,0 +1,82 @@
+// Package alert evaluates threshold rules against the exporter's own metrics
+// and sends firing and resolved alerts to an Alertmanager-style webhook.
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"exporter-demo/derive"
+
+	"github.com/prometheus/common/model"
+)
+
+// Config 为告警配置，没有规则时不做评估
+type Config struct {
+	WebhookURL         string         `yaml:"webhook_url"`
+	EvaluationInterval model.Duration `yaml:"evaluation_interval"`
+	RepeatInterval     model.Duration `yaml:"repeat_interval"` // 持续触发的告警重新发送的间隔
+	Timeout            model.Duration `yaml:"timeout"`         // 单次请求超时
+	MaxRetries         int            `yaml:"max_retries"`     // 发送失败后的重试次数
+	Rules              []*Rule        `yaml:"rules"`
+}
+
+// DefaultConfig 为未填写字段的默认值
+var DefaultConfig = Config{
+	EvaluationInterval: model.Duration(15 * time.Second),
+	RepeatInterval:     model.Duration(4 * time.Hour),
+	Timeout:            model.Duration(10 * time.Second),
+	MaxRetries:         3,
+}
+
+// Rule 的表达式语法与 derived_metrics 相同，结果中的每个序列都是一条告警，
+// 例如 stathe_scrape_collector_success == 0。
+type Rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        derive.Expr       `yaml:"expr"`
+	For         model.Duration    `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// Validate checks the settings that the YAML decoder cannot.
+func (c *Config) Validate() error {
+	if len(c.Rules) == 0 {
+		return nil
+	}
+	u, err := url.Parse(c.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook_url %q", c.WebhookURL)
+	}
+	if c.EvaluationInterval <= 0 || c.Timeout <= 0 {
+		return errors.New("evaluation_interval and timeout must be positive")
+	}
+	if c.MaxRetries < 0 {
+		return errors.New("max_retries must not be negative")
+	}
+	return nil
+}
+
+// Validate checks a single rule.
+func (r *Rule) Validate() error {
+	if !model.LabelValue(r.Alert).IsValid() || r.Alert == "" {
+		return fmt.Errorf("invalid alert name %q", r.Alert)
+	}
+	if r.Expr.Node == nil {
+		return fmt.Errorf("alert %s needs an expr", r.Alert)
+	}
+	if r.Expr.IsScalar() {
+		return fmt.Errorf("alert %s: expr %q must return a vector, not a scalar", r.Alert, r.Expr)
+	}
+	if r.For < 0 {
+		return fmt.Errorf("alert %s: for must not be negative", r.Alert)
+	}
+	for name := range r.Labels {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("alert %s: invalid label name %q", r.Alert, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package alert
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// queueCapacity 为等待发送的通知数上限，接收端长时间不可用时丢弃新的通知
+const queueCapacity = 100
+
+type state int
+
+const (
+	statePending state = iota
+	stateFiring
+)
+
+func (s state) String() string {
+	if s == stateFiring {
+		return "firing"
+	}
+	return "pending"
+}
+
+type activeAlert struct {
+	labels      model.Metric
+	annotations map[string]string
+	value       float64
+	state       state
+	activeAt    time.Time
+	lastSent    time.Time
+}
+
+// Manager 保存告警状态，配置重载后同名规则的告警状态保留
+type Manager struct {
+	logger *slog.Logger
+	client *http.Client
+
+	mu     sync.Mutex
+	cfg    Config
+	active map[model.Fingerprint]*activeAlert
+
+	queue         chan *Message
+	interrupted   chan *Message // 重载或关闭时正在发送的通知，由下一个 sendLoop 优先重新发送
+	backoff       time.Duration // 首次重试前的等待
+	alerts        *prometheus.Desc
+	notifications prometheus.Counter
+	failed        prometheus.Counter
+	dropped       prometheus.Counter
+}
+
+func NewManager(logger *slog.Logger) *Manager {
+	return &Manager{
+		logger:      logger,
+		client:      &http.Client{},
+		cfg:         DefaultConfig,
+		active:      make(map[model.Fingerprint]*activeAlert),
+		queue:       make(chan *Message, queueCapacity),
+		interrupted: make(chan *Message, queueCapacity),
+		backoff:     time.Second,
+		alerts:      prometheus.NewDesc("exporter_alerts", "Number of pending and firing alerts.", []string{"alertname", "state"}, nil),
+		notifications: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_alert_notifications_total",
+			Help: "Alert notifications sent to the webhook.",
+		}),
+		failed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_alert_notifications_failed_total",
+			Help: "Alert notifications that could not be delivered after all retries.",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_alert_notifications_dropped_total",
+			Help: "Alert notifications dropped because the send queue was full or their rule was removed.",
+		}),
+	}
+}
+
+// SetConfig replaces the rules. Alerts of rules that no longer exist are
+// forgotten without a resolved notification, and their queued notifications
+// are dropped.
+func (m *Manager) SetConfig(cfg Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg = cfg
+	names := make(map[string]bool, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		names[r.Alert] = true
+	}
+	for fp, a := range m.active {
+		if !names[string(a.labels[model.AlertNameLabel])] {
+			delete(m.active, fp)
+		}
+	}
+	// 没有规则时不再运行 sendLoop，留在队列中的通知永远不会发送
+	m.dropQueued(m.queue, names)
+	m.dropQueued(m.interrupted, names)
+}
+
+// dropQueued 丢弃 queue 中不属于 names 中规则的通知，其余按原顺序放回。
+// 调用方持有 mu，eval 不会同时入队
+func (m *Manager) dropQueued(queue chan *Message, names map[string]bool) {
+	for range len(queue) {
+		var msg *Message
+		select {
+		case msg = <-queue:
+		default:
+			// sendLoop 同时在取
+			return
+		}
+		if !names[msg.GroupLabels["alertname"]] {
+			m.dropped.Inc()
+			continue
+		}
+		select {
+		case queue <- msg:
+		default:
+			m.dropped.Inc()
+		}
+	}
+}
+
+func (m *Manager) config() Config {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg
+}
+
+// Run evaluates the rules on g every evaluation_interval and delivers the
+// notifications until ctx is done.
+func (m *Manager) Run(ctx context.Context, g prometheus.Gatherer) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.sendLoop(ctx)
+	}()
+	defer wg.Wait()
+
+	ticker := time.NewTicker(time.Duration(m.config().EvaluationInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.eval(g, now)
+		}
+	}
+}
+
+func (m *Manager) sendLoop(ctx context.Context) {
+	for {
+		var msg *Message
+		// 先发送上一个 sendLoop 被打断的通知，保持同一告警 firing 与 resolved 的顺序
+		select {
+		case msg = <-m.interrupted:
+		default:
+			select {
+			case <-ctx.Done():
+				return
+			case msg = <-m.interrupted:
+			case msg = <-m.queue:
+			}
+		}
+		if err := m.send(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				// 被打断的请求可能已经送达，重复发送由接收端去重，好过丢失
+				select {
+				case m.interrupted <- msg:
+				default:
+					m.dropped.Inc()
+				}
+				return
+			}
+			m.failed.Inc()
+			m.logger.Error("Error sending alert notification", "alertname", msg.GroupLabels["alertname"], "err", err)
+			continue
+		}
+		m.notifications.Inc()
+	}
+}
+
+func (m *Manager) eval(g prometheus.Gatherer, now time.Time) {
+	// Gather 出错时仍会返回其余指标，照常评估
+	mfs, _ := g.Gather()
+	samples, _ := expfmt.ExtractSamples(&expfmt.DecodeOptions{Timestamp: model.TimeFromUnixNano(now.UnixNano())}, mfs...)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.cfg.Rules {
+		alerts, err := m.evalRule(r, samples, now)
+		if err != nil {
+			m.logger.Warn("Error evaluating alert rule", "alertname", r.Alert, "err", err)
+			continue
+		}
+		if len(alerts) == 0 {
+			continue
+		}
+		select {
+		case m.queue <- newMessage(r.Alert, alerts):
+		default:
+			m.dropped.Inc()
+			m.logger.Error("Alert notification queue is full, dropping notification", "alertname", r.Alert)
+		}
+	}
+}
+
+// evalRule 更新一条规则的告警状态，返回需要发送的告警
+func (m *Manager) evalRule(r *Rule, samples model.Vector, now time.Time) ([]Alert, error) {
+	v, err := r.Expr.Eval(samples)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[model.Fingerprint]bool, len(v))
+	for _, smpl := range v {
+		labels := smpl.Metric.Clone()
+		delete(labels, model.MetricNameLabel)
+		for k, val := range r.Labels {
+			labels[model.LabelName(k)] = model.LabelValue(val)
+		}
+		labels[model.AlertNameLabel] = model.LabelValue(r.Alert)
+		fp := labels.Fingerprint()
+		seen[fp] = true
+
+		a, ok := m.active[fp]
+		if !ok {
+			a = &activeAlert{labels: labels, activeAt: now}
+			m.active[fp] = a
+		}
+		a.value = float64(smpl.Value)
+		a.annotations = expand(r.Annotations, labels, a.value)
+	}
+
+	var out []Alert
+	for fp, a := range m.active {
+		if string(a.labels[model.AlertNameLabel]) != r.Alert {
+			continue
+		}
+		switch {
+		case !seen[fp]:
+			delete(m.active, fp)
+			if a.state == stateFiring {
+				out = append(out, a.toAlert(StatusResolved, now))
+			}
+		case a.state == statePending && now.Sub(a.activeAt) >= time.Duration(r.For):
+			a.state = stateFiring
+			fallthrough
+		case a.state == stateFiring && now.Sub(a.lastSent) >= time.Duration(m.cfg.RepeatInterval):
+			a.lastSent = now
+			out = append(out, a.toAlert(StatusFiring, now))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Fingerprint < out[j].Fingerprint })
+	return out, nil
+}
+
+func (a *activeAlert) toAlert(status string, now time.Time) Alert {
+	labels := make(map[string]string, len(a.labels))
+	for k, v := range a.labels {
+		labels[string(k)] = string(v)
+	}
+	alert := Alert{
+		Status:      status,
+		Labels:      labels,
+		Annotations: a.annotations,
+		StartsAt:    a.activeAt,
+		Fingerprint: a.labels.Fingerprint().String(),
+	}
+	if status == StatusResolved {
+		alert.EndsAt = now
+	}
+	return alert
+}
+
+// expand 展开注解中的 {{ $labels.x }} 和 {{ $value }}，出错时保留原文
+func expand(annotations map[string]string, labels model.Metric, value float64) map[string]string {
+	data := struct {
+		Labels map[string]string
+		Value  float64
+	}{make(map[string]string, len(labels)), value}
+	for k, v := range labels {
+		data.Labels[string(k)] = string(v)
+	}
+
+	out := make(map[string]string, len(annotations))
+	for k, text := range annotations {
+		out[k] = text
+		tmpl, err := template.New(k).Option("missingkey=zero").Parse("{{$labels := .Labels}}{{$value := .Value}}" + text)
+		if err != nil {
+			continue
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err == nil {
+			out[k] = b.String()
+		}
+	}
+	return out
+}
+
+func (m *Manager) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.alerts
+	m.notifications.Describe(ch)
+	m.failed.Describe(ch)
+	m.dropped.Describe(ch)
+}
+
+func (m *Manager) Collect(ch chan<- prometheus.Metric) {
+	m.mu.Lock()
+	// 没有告警的规则也导出 0
+	counts := make(map[[2]string]int)
+	for _, r := range m.cfg.Rules {
+		counts[[2]string{r.Alert, statePending.String()}] = 0
+		counts[[2]string{r.Alert, stateFiring.String()}] = 0
+	}
+	for _, a := range m.active {
+		counts[[2]string{string(a.labels[model.AlertNameLabel]), a.state.String()}]++
+	}
+	m.mu.Unlock()
+
+	for k, n := range counts {
+		ch <- prometheus.MustNewConstMetric(m.alerts, prometheus.GaugeValue, float64(n), k[0], k[1])
+	}
+	m.notifications.Collect(ch)
+	m.failed.Collect(ch)
+	m.dropped.Collect(ch)
+}
@@ -0,0 +1,339 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"exporter-demo/derive"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+)
+
+// receiver 记录收到的通知，status 依次决定每个请求的响应码，用完后返回 200
+type receiver struct {
+	mu       sync.Mutex
+	status   []int
+	messages []*Message
+	requests int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var msg Message
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests++
+	code := http.StatusOK
+	if len(rc.status) > 0 {
+		code, rc.status = rc.status[0], rc.status[1:]
+	}
+	if code == http.StatusOK {
+		rc.messages = append(rc.messages, &msg)
+	}
+	w.WriteHeader(code)
+}
+
+func (rc *receiver) count() (requests, messages int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.requests, len(rc.messages)
+}
+
+func newTestManager(t *testing.T, url string, expr string, forDuration time.Duration) *Manager {
+	t.Helper()
+	e, err := derive.ParseExpr(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	m.backoff = time.Millisecond
+	cfg := DefaultConfig
+	cfg.WebhookURL = url
+	cfg.RepeatInterval = model.Duration(time.Hour)
+	cfg.Rules = []*Rule{{
+		Alert:       "HighLoad",
+		Expr:        e,
+		For:         model.Duration(forDuration),
+		Labels:      map[string]string{"severity": "page"},
+		Annotations: map[string]string{"summary": "load on {{ $labels.host }} is {{ $value }}"},
+	}}
+	m.SetConfig(cfg)
+	return m
+}
+
+// queued 取出 eval 放入队列的通知
+func queued(m *Manager) []*Message {
+	var out []*Message
+	for {
+		select {
+		case msg := <-m.queue:
+			out = append(out, msg)
+		default:
+			return out
+		}
+	}
+}
+
+func TestEvalStates(t *testing.T) {
+	load := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "load", Help: "Load."}, []string{"host"})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(load)
+	m := newTestManager(t, "http://127.0.0.1/", `load > 2`, 5*time.Minute)
+
+	t0 := time.Unix(1700000000, 0)
+	load.WithLabelValues("a").Set(3)
+	load.WithLabelValues("b").Set(1)
+
+	// 未满 for 之前处于 pending，不发送
+	for _, d := range []time.Duration{0, 4 * time.Minute} {
+		m.eval(reg, t0.Add(d))
+		if msgs := queued(m); len(msgs) != 0 {
+			t.Fatalf("eval at +%v sent %d notifications while pending", d, len(msgs))
+		}
+	}
+	if err := testutil.CollectAndCompare(m, strings.NewReader(`
+# HELP exporter_alerts Number of pending and firing alerts.
+# TYPE exporter_alerts gauge
+exporter_alerts{alertname="HighLoad",state="firing"} 0
+exporter_alerts{alertname="HighLoad",state="pending"} 1
+`), "exporter_alerts"); err != nil {
+		t.Error(err)
+	}
+
+	// 满 for 后转为 firing
+	m.eval(reg, t0.Add(5*time.Minute))
+	msgs := queued(m)
+	if len(msgs) != 1 || msgs[0].Status != StatusFiring || len(msgs[0].Alerts) != 1 {
+		t.Fatalf("got %+v, want one firing notification", msgs)
+	}
+	a := msgs[0].Alerts[0]
+	if a.Labels["host"] != "a" || a.Labels["severity"] != "page" || a.Labels["alertname"] != "HighLoad" {
+		t.Errorf("labels = %v", a.Labels)
+	}
+	if a.Annotations["summary"] != "load on a is 3" {
+		t.Errorf("summary = %q", a.Annotations["summary"])
+	}
+	if !a.StartsAt.Equal(t0) {
+		t.Errorf("startsAt = %v, want %v", a.StartsAt, t0)
+	}
+
+	// repeat_interval 之内不重复发送，之后重新发送
+	m.eval(reg, t0.Add(30*time.Minute))
+	if msgs := queued(m); len(msgs) != 0 {
+		t.Fatalf("resent within repeat_interval: %+v", msgs)
+	}
+	m.eval(reg, t0.Add(65*time.Minute))
+	if msgs := queued(m); len(msgs) != 1 || msgs[0].Status != StatusFiring {
+		t.Fatalf("got %+v, want a repeated firing notification", msgs)
+	}
+
+	// 新出现的 pending 告警消失时不发送 resolved
+	load.WithLabelValues("b").Set(5)
+	m.eval(reg, t0.Add(66*time.Minute))
+	load.WithLabelValues("b").Set(1)
+	m.eval(reg, t0.Add(67*time.Minute))
+	if msgs := queued(m); len(msgs) != 0 {
+		t.Fatalf("pending alert sent %+v", msgs)
+	}
+
+	// 序列消失后发送 resolved
+	load.DeleteLabelValues("a")
+	resolvedAt := t0.Add(68 * time.Minute)
+	m.eval(reg, resolvedAt)
+	msgs = queued(m)
+	if len(msgs) != 1 || msgs[0].Status != StatusResolved || len(msgs[0].Alerts) != 1 {
+		t.Fatalf("got %+v, want one resolved notification", msgs)
+	}
+	if !msgs[0].Alerts[0].EndsAt.Equal(resolvedAt) {
+		t.Errorf("endsAt = %v, want %v", msgs[0].Alerts[0].EndsAt, resolvedAt)
+	}
+	m.eval(reg, t0.Add(69*time.Minute))
+	if msgs := queued(m); len(msgs) != 0 {
+		t.Fatalf("resolved sent twice: %+v", msgs)
+	}
+}
+
+func TestSend(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		status   []int
+		requests int
+		sent     float64
+		failed   float64
+	}{
+		{"ok", nil, 1, 1, 0},
+		{"retry 5xx and 429", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 3, 1, 0},
+		{"give up after max_retries", []int{500, 500, 500, 500}, 4, 0, 1},
+		{"no retry on 4xx", []int{http.StatusBadRequest}, 1, 0, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := &receiver{status: tc.status}
+			srv := httptest.NewServer(rc)
+			defer srv.Close()
+			m := newTestManager(t, srv.URL, `load > 2`, 0)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				m.sendLoop(ctx)
+			}()
+			m.queue <- newMessage("HighLoad", []Alert{{Status: StatusFiring, Labels: map[string]string{"alertname": "HighLoad"}}})
+			waitFor(t, func() bool {
+				return testutil.ToFloat64(m.notifications)+testutil.ToFloat64(m.failed) == 1
+			})
+			cancel()
+			<-done
+
+			if requests, _ := rc.count(); requests != tc.requests {
+				t.Errorf("requests = %d, want %d", requests, tc.requests)
+			}
+			if got := testutil.ToFloat64(m.notifications); got != tc.sent {
+				t.Errorf("sent = %v, want %v", got, tc.sent)
+			}
+			if got := testutil.ToFloat64(m.failed); got != tc.failed {
+				t.Errorf("failed = %v, want %v", got, tc.failed)
+			}
+		})
+	}
+}
+
+// 重载取消 sendLoop 时正在发送的通知由下一个 sendLoop 重新发送
+func TestSendInterrupted(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		block   = true
+		started = make(chan struct{}, 1)
+	)
+	rc := &receiver{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		b := block
+		mu.Unlock()
+		if b {
+			// 读完请求体后服务端才能发现客户端断开
+			io.Copy(io.Discard, r.Body)
+			started <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		rc.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	m := newTestManager(t, srv.URL, `load > 2`, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.sendLoop(ctx)
+	}()
+	m.queue <- newMessage("HighLoad", []Alert{{Status: StatusFiring, Labels: map[string]string{"alertname": "HighLoad"}}})
+	<-started
+	cancel()
+	<-done
+
+	mu.Lock()
+	block = false
+	mu.Unlock()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go m.sendLoop(ctx)
+	waitFor(t, func() bool { return testutil.ToFloat64(m.notifications) == 1 })
+	if _, n := rc.count(); n != 1 {
+		t.Errorf("received %d notifications, want 1", n)
+	}
+	if got := testutil.ToFloat64(m.dropped); got != 0 {
+		t.Errorf("dropped = %v, want 0", got)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 删除规则或关闭告警后，队列中对应的通知被丢弃并计入 dropped
+func TestSetConfigDropsQueued(t *testing.T) {
+	load := prometheus.NewGauge(prometheus.GaugeOpts{Name: "load", Help: "Load."})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(load)
+	load.Set(3)
+	m := newTestManager(t, "http://127.0.0.1/", `load > 2`, 0)
+	other, err := derive.ParseExpr(`load > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := m.config()
+	cfg.Rules = append(cfg.Rules, &Rule{Alert: "Busy", Expr: other})
+	m.SetConfig(cfg)
+	m.eval(reg, time.Unix(1700000000, 0))
+	m.interrupted <- &Message{GroupLabels: map[string]string{"alertname": "HighLoad"}}
+
+	// 只保留 Busy
+	cfg.Rules = cfg.Rules[1:]
+	m.SetConfig(cfg)
+	if got := testutil.ToFloat64(m.dropped); got != 2 {
+		t.Errorf("dropped = %v, want 2", got)
+	}
+	if len(m.interrupted) != 0 {
+		t.Errorf("%d interrupted notifications left", len(m.interrupted))
+	}
+	if len(m.queue) != 1 {
+		t.Fatalf("%d notifications left in the queue, want the one of Busy", len(m.queue))
+	}
+	if msg := <-m.queue; msg.GroupLabels["alertname"] != "Busy" {
+		t.Errorf("kept notification of %s", msg.GroupLabels["alertname"])
+	}
+
+	// 关闭告警时清空队列
+	m.eval(reg, time.Unix(1700000000, 0).Add(2*time.Hour))
+	m.SetConfig(DefaultConfig)
+	if got := testutil.ToFloat64(m.dropped); got != 3 {
+		t.Errorf("dropped = %v, want 3", got)
+	}
+	if len(m.queue) != 0 {
+		t.Errorf("%d notifications left after alerting was disabled", len(m.queue))
+	}
+}
+
+func TestRuleValidateScalar(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		ok   bool
+	}{
+		{`1 + 1`, false},
+		{`-(2 * 3)`, false},
+		{`load > 2`, true},
+		{`1 + load`, true},
+		{`sum(load) > 0`, true},
+	} {
+		e, err := derive.ParseExpr(tc.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &Rule{Alert: "A", Expr: e}
+		if err := r.Validate(); (err == nil) != tc.ok {
+			t.Errorf("Validate(%q) = %v, want ok %v", tc.expr, err, tc.ok)
+		}
+	}
+}
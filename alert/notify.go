@@ -0,0 +1,126 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Message 为 Alertmanager webhook 格式（version 4）的通知
+type Message struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []Alert           `json:"alerts"`
+}
+
+// Alert 为通知中的单条告警
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// newMessage 把同一规则的告警组成一条通知
+func newMessage(alertname string, alerts []Alert) *Message {
+	msg := &Message{
+		Version:           "4",
+		GroupKey:          fmt.Sprintf("{}:{alertname=%q}", alertname),
+		Status:            StatusResolved,
+		Receiver:          "webhook",
+		GroupLabels:       map[string]string{"alertname": alertname},
+		CommonLabels:      common(alerts, func(a Alert) map[string]string { return a.Labels }),
+		CommonAnnotations: common(alerts, func(a Alert) map[string]string { return a.Annotations }),
+		Alerts:            alerts,
+	}
+	for _, a := range alerts {
+		if a.Status == StatusFiring {
+			msg.Status = StatusFiring
+		}
+	}
+	return msg
+}
+
+// common 返回所有告警都相同的键值
+func common(alerts []Alert, get func(Alert) map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range get(alerts[0]) {
+		out[k] = v
+	}
+	for _, a := range alerts[1:] {
+		m := get(a)
+		for k, v := range out {
+			if m[k] != v {
+				delete(out, k)
+			}
+		}
+	}
+	return out
+}
+
+// maxBackoff 为两次重试之间的最长等待
+const maxBackoff = 30 * time.Second
+
+// send 投递一条通知，网络错误、5xx 和 429 按指数退避重试
+func (m *Manager) send(ctx context.Context, msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	cfg := m.config()
+	backoff := m.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := m.post(ctx, cfg.WebhookURL, time.Duration(cfg.Timeout), body)
+		if err == nil || !retry || attempt >= cfg.MaxRetries {
+			return err
+		}
+		m.logger.Warn("Error sending alert notification, retrying", "alertname", msg.GroupLabels["alertname"],
+			"attempt", attempt+1, "backoff", backoff.String(), "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+func (m *Manager) post(ctx context.Context, url string, timeout time.Duration, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry = resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook returned HTTP status %s", resp.Status)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	scrapeCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "exporter_scrape_cache_hits_total",
+		Help: "Scrapes answered from the cached result of an earlier collection.",
+	})
+	scrapeCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "exporter_scrape_cache_misses_total",
+		Help: "Scrapes that triggered a new collection.",
+	})
+)
+
+// cachingGatherer 在 interval 内复用上一次 Gather 的结果，只用于 HTTP 采集。
+// 采集时不持锁：同时到达的请求共用同一次采集，已有旧结果时直接返回旧结果，
+// 不会因为某个慢采集器排队等待。
+type cachingGatherer struct {
+	g        prometheus.Gatherer
+	interval time.Duration
+
+	mu      sync.Mutex
+	last    time.Time
+	mfs     []*dto.MetricFamily
+	err     error
+	pending *gatherCall // 进行中的采集，没有时为 nil
+}
+
+type gatherCall struct {
+	done chan struct{}
+	mfs  []*dto.MetricFamily
+	err  error
+}
+
+func newCachingGatherer(g prometheus.Gatherer, interval time.Duration) *cachingGatherer {
+	return &cachingGatherer{g: g, interval: interval}
+}
+
+func (c *cachingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	c.mu.Lock()
+	cached := !c.last.IsZero()
+	if cached && (time.Since(c.last) < c.interval || c.pending != nil) {
+		mfs, err := c.mfs, c.err
+		c.mu.Unlock()
+		scrapeCacheHits.Inc()
+		return mfs, err
+	}
+	if call := c.pending; call != nil {
+		// 还没有任何结果，等待进行中的首次采集
+		c.mu.Unlock()
+		<-call.done
+		scrapeCacheHits.Inc()
+		return call.mfs, call.err
+	}
+	call := &gatherCall{done: make(chan struct{})}
+	c.pending = call
+	c.mu.Unlock()
+
+	scrapeCacheMisses.Inc()
+	call.mfs, call.err = c.g.Gather()
+
+	c.mu.Lock()
+	c.mfs, c.err, c.last = call.mfs, call.err, time.Now()
+	c.pending = nil
+	c.mu.Unlock()
+	close(call.done)
+	return call.mfs, call.err
+}
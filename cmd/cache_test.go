@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCachingGathererDoesNotBlockOnSlowGather(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	g := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		if calls.Add(1) > 1 {
+			<-release
+		}
+		return []*dto.MetricFamily{{}}, nil
+	})
+	c := newCachingGatherer(g, time.Nanosecond)
+
+	if _, err := c.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	slow := make(chan struct{})
+	go func() {
+		c.Gather()
+		close(slow)
+	}()
+	for calls.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 第二次采集卡住时，其余请求立即拿到上一次的结果
+	done := make(chan struct{})
+	go func() {
+		if mfs, _ := c.Gather(); len(mfs) != 1 {
+			t.Errorf("got %d families from the cache, want 1", len(mfs))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Gather blocked behind an in-flight collection")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("underlying Gather called %d times, want 2", n)
+	}
+	close(release)
+	<-slow
+}
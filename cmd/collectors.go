@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"exporter-demo/collect"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// collectorPool 跨重载保留设置未变的采集器，kmsg 这类后台采集器不会因重载重置计数或漏掉事件。
+// 只在持有 exporter.mu 时使用
+type collectorPool struct {
+	logger  *slog.Logger
+	running map[string]*pooledCollector
+}
+
+type pooledCollector struct {
+	settings any
+	ic       *collect.Instrumented
+	cancel   context.CancelFunc
+	done     chan struct{} // 后台 goroutine 退出后关闭，不是 Runner 时为 nil
+}
+
+func newCollectorPool(logger *slog.Logger) *collectorPool {
+	return &collectorPool{logger: logger, running: make(map[string]*pooledCollector)}
+}
+
+// collectorSet 为一次重载要使用的采集器，commit 之前新建的采集器不会启动
+type collectorSet struct {
+	pool       *collectorPool
+	collectors map[string]*pooledCollector
+}
+
+// prepare 按 cfg 创建设置有变化或新开启的采集器，其余沿用正在运行的实例
+func (p *collectorPool) prepare(cfg collect.Config) (*collectorSet, error) {
+	set := &collectorSet{pool: p, collectors: make(map[string]*pooledCollector)}
+	for name, settings := range collect.Settings(cfg) {
+		if old, ok := p.running[name]; ok && reflect.DeepEqual(old.settings, settings) {
+			set.collectors[name] = old
+			continue
+		}
+		c, err := collect.NewCollector(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		set.collectors[name] = &pooledCollector{settings: settings, ic: collect.Instrument(name, c, p.logger)}
+	}
+	return set, nil
+}
+
+// instrumented 按名称排序返回
+func (s *collectorSet) instrumented() []*collect.Instrumented {
+	var out []*collect.Instrumented
+	for _, name := range slices.Sorted(maps.Keys(s.collectors)) {
+		out = append(out, s.collectors[name].ic)
+	}
+	return out
+}
+
+// commit 停止被替换或关闭的采集器，启动新建采集器的后台 goroutine
+func (s *collectorSet) commit() {
+	p := s.pool
+	for name, old := range p.running {
+		if s.collectors[name] != old {
+			old.stop()
+		}
+	}
+	for name, pc := range s.collectors {
+		if p.running[name] == pc {
+			continue
+		}
+		r, ok := pc.ic.Collector.(collect.Runner)
+		if !ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		pc.cancel, pc.done = cancel, make(chan struct{})
+		go func() {
+			defer close(pc.done)
+			if err := r.Run(ctx); err != nil {
+				p.logger.Error("Collector stopped", "collector", name, "err", err)
+			}
+		}()
+	}
+	p.running = s.collectors
+}
+
+// close 停止所有后台采集
+func (p *collectorPool) close() {
+	for _, pc := range p.running {
+		pc.stop()
+	}
+	p.running = make(map[string]*pooledCollector)
+}
+
+func (pc *pooledCollector) stop() {
+	if pc.cancel != nil {
+		pc.cancel()
+		<-pc.done
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+)
+
+var collectorsTemplate = template.Must(template.New("collectors").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Collectors</title></head>
+<body>
+<h1>Collectors</h1>
+<table border="1" cellpadding="4">
+<tr><th>Name</th><th>Last scrape</th><th>Duration</th><th>Last error</th></tr>
+{{- range .}}
+{{- $s := .Status}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{if $s.LastScrape.IsZero}}never{{else}}{{$s.LastScrape.Format "2006-01-02 15:04:05.000"}}{{end}}</td>
+<td>{{$s.Duration}}</td>
+<td>{{if $s.Err}}{{$s.Err}}{{else}}-{{end}}</td>
+</tr>
+{{- end}}
+</table>
+<p><a href="/debug/pprof/">pprof</a> &middot; <a href="/debug/goroutines">goroutines</a></p>
+</body>
+</html>
+`))
+
+// registerDebugHandlers 挂载 pprof 和调试页面，与 /metrics 共用同一套认证
+func (e *exporter) registerDebugHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/collectors", e.collectorsHandler)
+	mux.HandleFunc("/debug/goroutines", goroutinesHandler)
+}
+
+func (e *exporter) collectorsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := collectorsTemplate.Execute(w, e.state.Load().collectors); err != nil {
+		e.logger.Error("Error rendering collectors page", "err", err)
+	}
+}
+
+// goroutinesHandler 输出所有 goroutine 的完整堆栈
+func goroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"exporter-demo/collect"
+	"exporter-demo/lint"
+	"fmt"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// collectorFamilies 返回各采集器导出的指标名（带 namespace）对应的采集器。
+// scrape_collector_* 这类所有采集器共用的指标对应多个采集器，按 collector 标签区分序列
+func collectorFamilies(namespace string, instrumented []*collect.Instrumented) map[string][]string {
+	families := make(map[string][]string)
+	for _, ic := range instrumented {
+		descs := make(chan *prometheus.Desc)
+		go func() {
+			ic.Describe(descs)
+			close(descs)
+		}()
+		for d := range descs {
+			name, _, ok := lint.DescName(d)
+			if !ok {
+				continue
+			}
+			if namespace != "" {
+				name = namespace + "_" + name
+			}
+			if !slices.Contains(families[name], ic.Name) {
+				families[name] = append(families[name], ic.Name)
+			}
+		}
+	}
+	return families
+}
+
+// selectCollectors 按 collect[] 和 exclude[] 返回选中的采集器，名称未知或未开启时报错
+func (s *exporterState) selectCollectors(include, exclude []string) (map[string]bool, error) {
+	selected := make(map[string]bool, len(s.collectors))
+	for _, c := range s.collectors {
+		selected[c.Name] = len(include) == 0
+	}
+	for _, name := range slices.Concat(include, exclude) {
+		if _, ok := selected[name]; !ok {
+			return nil, fmt.Errorf("unknown or disabled collector %q", name)
+		}
+	}
+	for _, name := range include {
+		selected[name] = true
+	}
+	for _, name := range exclude {
+		selected[name] = false
+	}
+	return selected, nil
+}
+
+// filteredGatherer 从 HTTP 采集使用的（可能带缓存的）结果中只保留选中采集器的指标，
+// 不属于任何采集器的指标（Go 运行时、进程、target_info 等）原样保留。
+// 返回的 family 为新建的，不修改缓存中的数据
+func (s *exporterState) filteredGatherer(selected map[string]bool) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := s.scrape.Gather()
+		out := make([]*dto.MetricFamily, 0, len(mfs))
+		for _, mf := range mfs {
+			owners := s.families[mf.GetName()]
+			switch {
+			case len(owners) == 0:
+				out = append(out, mf)
+			case len(owners) == 1:
+				if selected[owners[0]] {
+					out = append(out, mf)
+				}
+			default:
+				filtered := &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type, Unit: mf.Unit}
+				for _, m := range mf.GetMetric() {
+					if selected[collectorLabel(m)] {
+						filtered.Metric = append(filtered.Metric, m)
+					}
+				}
+				if len(filtered.Metric) > 0 {
+					out = append(out, filtered)
+				}
+			}
+		}
+		return out, err
+	})
+}
+
+func collectorLabel(m *dto.Metric) string {
+	for _, lp := range m.GetLabel() {
+		if lp.GetName() == "collector" {
+			return lp.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func scrape(t *testing.T, e *exporter, query string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics"+query, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestFilterCollectors(t *testing.T) {
+	e, _ := newTestExporter(t, fmtConfig("stathe"))
+
+	for _, tc := range []struct {
+		query   string
+		want    []string
+		notWant []string
+	}{
+		{
+			query: "?collect[]=kmsg",
+			want: []string{
+				"stathe_kmsg_events_total",
+				`stathe_scrape_collector_success{collector="kmsg"}`,
+				// 不属于采集器的指标和 exporter 自身的指标照常导出
+				"go_goroutines",
+				"exporter_build_info",
+				"exporter_config_last_reload_successful",
+			},
+			notWant: []string{"stathe_system_load_average", `collector="loadavg"`},
+		},
+		{
+			query:   "?exclude[]=kmsg",
+			want:    []string{"stathe_system_load_average", `collector="loadavg"`, "go_goroutines", "exporter_build_info"},
+			notWant: []string{"stathe_kmsg_events_total", `collector="kmsg"`},
+		},
+		{
+			query:   "?collect[]=kmsg&collect[]=loadavg&exclude[]=loadavg",
+			want:    []string{"stathe_kmsg_events_total"},
+			notWant: []string{"stathe_system_load_average"},
+		},
+	} {
+		code, body := scrape(t, e, tc.query)
+		if code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", tc.query, code, body)
+		}
+		for _, s := range tc.want {
+			if !strings.Contains(body, s) {
+				t.Errorf("%s: missing %s", tc.query, s)
+			}
+		}
+		for _, s := range tc.notWant {
+			if strings.Contains(body, s) {
+				t.Errorf("%s: unexpected %s", tc.query, s)
+			}
+		}
+	}
+}
+
+func TestFilterUnknownCollector(t *testing.T) {
+	e, _ := newTestExporter(t, fmtConfig("stathe"))
+
+	// timex 在测试配置中未开启
+	for _, query := range []string{"?collect[]=nope", "?exclude[]=nope", "?collect[]=timex"} {
+		code, body := scrape(t, e, query)
+		if code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, code)
+		}
+		if !strings.Contains(body, "unknown or disabled collector") {
+			t.Errorf("%s: body = %q", query, body)
+		}
+	}
+}
+
+func TestFilterUsesScrapeCache(t *testing.T) {
+	e, _ := newTestExporter(t, "scrape_cache_interval: 1h\n"+fmtConfig("stathe"))
+
+	scrape(t, e, "")
+	hits := testutil.ToFloat64(scrapeCacheHits)
+	code, body := scrape(t, e, "?collect[]=loadavg")
+	if code != http.StatusOK || !strings.Contains(body, "stathe_system_load_average") {
+		t.Fatalf("status = %d: %s", code, body)
+	}
+	if got := testutil.ToFloat64(scrapeCacheHits); got != hits+1 {
+		t.Errorf("cache hits = %v, want %v", got, hits+1)
+	}
+}
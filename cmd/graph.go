@@ -0,0 +1,16 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// graphPage 为 /graph 的单页界面，数据来自 /api/v1 下的 history 接口，不依赖外部资源
+//
+//go:embed ui/graph.html
+var graphPage []byte
+
+func graphHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(graphPage)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGraphHandler(t *testing.T) {
+	for _, tc := range []struct {
+		history string
+		want    int
+	}{
+		{"false", http.StatusNotFound},
+		{"true", http.StatusOK},
+	} {
+		e, _ := newTestExporter(t, "history:\n  enabled: "+tc.history+"\n"+fmtConfig("stathe"))
+		w := httptest.NewRecorder()
+		e.historyHandler(graphHandler)(w, httptest.NewRequest(http.MethodGet, "/graph", nil))
+		if w.Code != tc.want {
+			t.Errorf("history enabled %s: status = %d, want %d", tc.history, w.Code, tc.want)
+			continue
+		}
+		if tc.want != http.StatusOK {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		// 页面嵌入在二进制中，通过相对路径调用 history 接口
+		body := w.Body.Bytes()
+		if len(graphPage) == 0 || !bytes.Equal(body, graphPage) {
+			t.Error("response is not the embedded graph page")
+		}
+		if !bytes.Contains(body, []byte(`"api/v1/"`)) {
+			t.Error("graph page does not call the history API")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"exporter-demo/config"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/version"
+)
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Exporter</title></head>
+<body>
+<h1>Exporter</h1>
+<p>Version: {{.Version}}</p>
+<p>Build: {{.BuildContext}}</p>
+<p><a href="{{.Config.TelemetryPath}}">Metrics</a> &middot; <a href="/-/healthy">Healthy</a> &middot; <a href="/-/ready">Ready</a>{{if .Config.History.Enabled}} &middot; <a href="/graph">Graph</a>{{end}}</p>
+<h2>Collectors</h2>
+<table border="1" cellpadding="4">
+<tr><th>Name</th><th>Last scrape</th><th>Duration</th><th>Success</th><th>Error</th></tr>
+{{- range .Collectors}}
+{{- $s := .Status}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{if $s.LastScrape.IsZero}}never{{else}}{{$s.LastScrape.Format "2006-01-02 15:04:05"}}{{end}}</td>
+<td>{{$s.Duration}}</td>
+<td>{{$s.Success}}</td>
+<td>{{if $s.Err}}{{$s.Err}}{{end}}</td>
+</tr>
+{{- end}}
+</table>
+<h2>Configuration</h2>
+<table border="1" cellpadding="4">
+<tr><td>Config file</td><td>{{if .ConfigFile}}{{.ConfigFile}}{{else}}built-in defaults{{end}}</td></tr>
+{{- range .Summary}}
+<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// landingHandler 列出已启用的采集器、版本和配置摘要，只响应 /。
+// 页面可能无需认证即可访问，配置中的 URL、headers 等可能含有凭据，不直接展示
+func (e *exporter) landingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	state := e.state.Load()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := landingTemplate.Execute(w, map[string]any{
+		"Version":      version.Info(),
+		"BuildContext": version.BuildContext(),
+		"Config":       state.cfg,
+		"ConfigFile":   e.configFile,
+		"Summary":      configSummary(state.cfg),
+		"Collectors":   state.collectors,
+	})
+	if err != nil {
+		e.logger.Error("Error rendering landing page", "err", err)
+	}
+}
+
+type summaryItem struct {
+	Name, Value string
+}
+
+// configSummary 只列出不含凭据的设置和各功能是否开启
+func configSummary(cfg *config.Config) []summaryItem {
+	onOff := func(on bool) string {
+		if on {
+			return "enabled"
+		}
+		return "disabled"
+	}
+	var collectors []string
+	for name, on := range map[string]bool{
+		"loadavg": cfg.Collectors.Loadavg.Enabled,
+		"timex":   cfg.Collectors.Timex.Enabled,
+		"utmp":    cfg.Collectors.Utmp.Enabled,
+		"kmsg":    cfg.Collectors.Kmsg.Enabled,
+	} {
+		if on {
+			collectors = append(collectors, name)
+		}
+	}
+	slices.Sort(collectors)
+	return []summaryItem{
+		{"Telemetry path", cfg.TelemetryPath},
+		{"Namespace", cfg.Namespace},
+		{"Collectors", strings.Join(collectors, ", ")},
+		{"Metric lint", string(cfg.MetricLint)},
+		{"Scrape cache", cfg.ScrapeCacheInterval.String()},
+		{"Target info", onOff(cfg.TargetInfo.Enabled)},
+		{"History", onOff(cfg.History.Enabled)},
+		{"Derived metrics", strconv.Itoa(len(cfg.DerivedMetrics))},
+		{"Metric relabel rules", strconv.Itoa(len(cfg.MetricRelabelConfigs))},
+		{"Alert rules", strconv.Itoa(len(cfg.Alerting.Rules))},
+		{"Remote write", onOff(cfg.RemoteWrite.Enabled())},
+		{"OTLP export", onOff(cfg.OTLP.Enabled())},
+	}
+}
+
+// healthyHandler 进程存活即返回 200
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Healthy.\n"))
+}
+
+// readyHandler 配置已加载且未进入关闭流程时返回 200
+func (e *exporter) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if e.state.Load() == nil || e.ctx.Err() != nil {
+		http.Error(w, "Not ready.", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Ready.\n"))
+}
@@ -1,18 +1,156 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"exporter-demo/collect"
+	"exporter-demo/config"
+	"exporter-demo/lint"
+	"exporter-demo/logging"
+	"exporter-demo/web"
+	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/common/version"
+)
+
+var (
+	configFile    = flag.String("config.file", "", "Path to the YAML configuration file, built-in defaults are used if empty.")
+	webConfigFile = flag.String("web.config.file", "", "Path to a web configuration file enabling TLS or basic authentication, in Prometheus exporter-toolkit format.")
+	gracePeriod   = flag.Duration("web.shutdown-grace-period", 30*time.Second, "How long in-flight scrapes may take to finish on SIGTERM/SIGINT.")
+	logLevel      = flag.String("log.level", "info", "Only log messages with the given severity or above. One of: [debug, info, warn, error]")
+	enableDebug   = flag.Bool("web.enable-debug", false, "Serve pprof, /debug/collectors and /debug/goroutines, behind the same authentication as the metrics.")
+	logFormat     = flag.String("log.format", "logfmt", "Output format of log messages. One of: [logfmt, json]")
+	printVersion  = flag.Bool("version", false, "Print version information and exit.")
 )
 
 func main() {
-	http.HandleFunc("/metrics", collect.MetricsHandler)
-	fmt.Println("Starting HTTP metrics server on :8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		fmt.Printf("Error starting HTTP server: %v\n", err)
+	flag.Parse()
+	if *printVersion {
+		fmt.Println(version.Print(programName))
+		return
+	}
+	logger, err := logging.New(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := run(logger); err != nil {
+		logger.Error("Exporter failed", "err", err)
 		os.Exit(1)
 	}
+}
+
+func run(logger *slog.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	e := newExporter(ctx, *configFile, logger)
+	if err := e.Reload(); err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	defer e.Close()
+	cfg := e.Config()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go e.watchReloads(ctx, hup)
+
+	mux := http.NewServeMux()
+	mux.Handle(cfg.TelemetryPath, e)
+	mux.HandleFunc("/-/reload", e.reloadHandler)
+	mux.HandleFunc("/-/healthy", healthyHandler)
+	mux.HandleFunc("/-/ready", e.readyHandler)
+	mux.HandleFunc("/api/v1/query_range", e.historyHandler(e.history.QueryRangeHandler))
+	mux.HandleFunc("/api/v1/series", e.historyHandler(e.history.SeriesHandler))
+	mux.HandleFunc("/api/v1/label/{name}/values", e.historyHandler(e.history.LabelValuesHandler))
+	mux.HandleFunc("/graph", e.historyHandler(graphHandler))
+	mux.HandleFunc("/", e.landingHandler)
+	if *enableDebug {
+		e.registerDebugHandlers(mux)
+	}
+	logger.Info("Starting HTTP metrics server", "version", version.Info(), "build_context", version.BuildContext(),
+		"telemetry_path", cfg.TelemetryPath)
+	server := &http.Server{Handler: mux, ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError)}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- web.ListenAndServe(server, cfg.ListenConfig(), *webConfigFile, logger)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("starting HTTP server: %w", err)
+	case <-ctx.Done():
+	}
 
+	// 停止接收新连接，等待进行中的采集在宽限期内完成
+	logger.Info("Shutting down, waiting for in-flight requests", "grace_period", gracePeriod.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *gracePeriod)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// 超过宽限期仍属于正常退出，强制断开剩余连接
+		logger.Warn("Shutdown grace period exceeded, closing remaining connections", "grace_period", gracePeriod.String())
+		server.Close()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("shutting down HTTP server: %w", err)
+	}
+	return nil
+}
+
+// newRegistry 注册 collectors 和内置采集器，外部标签作用于所有指标，namespace 只作用于自定义采集器。
+// 采集 reg 时需经过返回的 lint.Registerer 的 Gatherer
+func newRegistry(cfg *config.Config, instrumented []*collect.Instrumented, logger *slog.Logger) (*prometheus.Registry, *lint.Registerer, error) {
+	reg := prometheus.NewRegistry()
+	linted := lint.NewRegisterer(reg, cfg.MetricLint, logger)
+	if cfg.MetricLint == lint.Warn {
+		prometheus.WrapRegistererWithPrefix("exporter_", reg).MustRegister(linted)
+	}
+	labeled, prefixed := wrapRegisterer(linted, cfg)
+	labeled.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if err := registerTargetInfo(labeled, cfg); err != nil {
+		return nil, nil, err
+	}
+	for _, ic := range instrumented {
+		if err := prefixed.Register(ic); err != nil {
+			return nil, nil, fmt.Errorf("registering %s collector: %w", ic.Name, err)
+		}
+	}
+	return reg, linted, nil
+}
+
+// wrapRegisterer 返回只加外部标签的 Registerer，以及同时加 namespace 前缀的 Registerer
+func wrapRegisterer(reg prometheus.Registerer, cfg *config.Config) (labeled, prefixed prometheus.Registerer) {
+	labeled = prometheus.WrapRegistererWith(cfg.ExternalLabels, reg)
+	prefixed = labeled
+	if cfg.Namespace != "" {
+		prefixed = prometheus.WrapRegistererWithPrefix(cfg.Namespace+"_", labeled)
+	}
+	return labeled, prefixed
+}
+
+// registerTargetInfo 注册不带 namespace 前缀的 target_info
+func registerTargetInfo(labeled prometheus.Registerer, cfg *config.Config) error {
+	if !cfg.TargetInfo.Enabled {
+		return nil
+	}
+	c, err := collect.NewTargetInfoCollector(cfg.TargetInfo)
+	if err != nil {
+		return fmt.Errorf("target_info: %w", err)
+	}
+	return labeled.Register(c)
 }
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"exporter-demo/alert"
+	"exporter-demo/collect"
+	"exporter-demo/config"
+	"exporter-demo/derive"
+	"exporter-demo/history"
+	"exporter-demo/otlp"
+	"exporter-demo/relabel"
+	"exporter-demo/remote"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// exporter 持有当前配置对应的采集器集合，重载时整体替换
+type exporter struct {
+	ctx        context.Context
+	configFile string
+	logger     *slog.Logger
+
+	mu    sync.Mutex // 串行化重载
+	state atomic.Pointer[exporterState]
+
+	buildInfo       prometheus.Gauge
+	reloadSuccess   prometheus.Gauge
+	reloadTimestamp prometheus.Gauge
+
+	collectors *collectorPool
+
+	// history、alerts、remote 和 otlp 跨重载保留，由当前 state 的后台 goroutine 写入、评估和发送
+	history *history.Store
+	alerts  *alert.Manager
+	remote  *remote.Sender
+	otlp    *otlp.Exporter
+}
+
+type exporterState struct {
+	cfg        *config.Config
+	collectors []*collect.Instrumented
+	families   map[string][]string // 指标名对应的采集器，见 collectorFamilies
+	handler    http.Handler
+	scrape     prometheus.Gatherer // HTTP 采集使用的结果，未经派生和重写
+	meta       prometheus.Gatherer // exporter 自身的指标
+	transform  func(prometheus.Gatherer) prometheus.Gatherer
+	inFlight   chan struct{} // 并发采集数限制，nil 为不限制
+	cancel     context.CancelFunc
+	wg         *sync.WaitGroup // history、告警和推送的后台 goroutine
+}
+
+// newExporter 的 ctx 取消后 /-/ready 返回 503，后台 goroutine 只在 Close 时退出，
+// 这样关闭 HTTP server 期间进行中的采集仍能读到完整数据
+func newExporter(ctx context.Context, configFile string, logger *slog.Logger) *exporter {
+	return &exporter{
+		ctx:        ctx,
+		configFile: configFile,
+		logger:     logger,
+		buildInfo:  newBuildInfo(),
+		collectors: newCollectorPool(logger),
+		history:    history.NewStore(time.Duration(history.DefaultConfig.Retention)),
+		alerts:     alert.NewManager(logger),
+		remote:     remote.NewSender(logger),
+		otlp:       otlp.NewExporter(logger),
+		reloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "exporter_config_last_reload_successful",
+			Help: "Whether the last configuration reload attempt was successful.",
+		}),
+		reloadTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "exporter_config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful configuration reload.",
+		}),
+	}
+}
+
+// handlerOpts 中的采集错误已由 collect.Instrumented 限频记录，这里只按 debug 级别输出
+func (e *exporter) handlerOpts() promhttp.HandlerOpts {
+	return promhttp.HandlerOpts{
+		ErrorLog:          slog.NewLogLogger(e.logger.Handler(), slog.LevelDebug),
+		ErrorHandling:     promhttp.ContinueOnError,
+		EnableOpenMetrics: true,
+	}
+}
+
+func (e *exporter) loadConfig() (*config.Config, error) {
+	if e.configFile == "" {
+		return config.Default(), nil
+	}
+	return config.LoadFile(e.configFile)
+}
+
+// Reload loads the config file and swaps in a freshly built registry. Scrapes
+// already running keep using the old one; on failure the old one stays.
+// Collectors whose settings did not change are kept running. Reload returns
+// after the background goroutines of the old state have exited.
+func (e *exporter) Reload() error {
+	e.mu.Lock()
+	old, err := e.reload()
+	if err != nil {
+		e.reloadSuccess.Set(0)
+	} else {
+		e.reloadSuccess.Set(1)
+		e.reloadTimestamp.SetToCurrentTime()
+	}
+	e.mu.Unlock()
+
+	if old != nil {
+		old.wg.Wait()
+		// 旧的 history 记录 goroutine 退出后才能清空，否则可能在清空后再写入
+		if state := e.state.Load(); !state.cfg.History.Enabled {
+			e.history.Reset()
+		}
+	}
+	return err
+}
+
+// reload 替换 state 并取消旧 state 的后台 goroutine，返回旧 state，由调用方在释放 mu 后等待
+func (e *exporter) reload() (*exporterState, error) {
+	cfg, err := e.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := e.collectors.prepare(cfg.Collectors)
+	if err != nil {
+		return nil, err
+	}
+	collectors := set.instrumented()
+	reg, linted, err := newRegistry(cfg, collectors, e.logger)
+	if err != nil {
+		return nil, err
+	}
+	set.commit()
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(e.ctx))
+	wg := &sync.WaitGroup{}
+	// exporter 自身的指标不进入缓存
+	meta := prometheus.NewRegistry()
+	meta.MustRegister(e.buildInfo, e.reloadSuccess, e.reloadTimestamp, scrapeCacheHits, scrapeCacheMisses, e.alerts, e.remote, e.otlp)
+	transform := func(g prometheus.Gatherer) prometheus.Gatherer {
+		return relabel.Gatherer(derive.Gatherer(g, cfg.DerivedMetrics), cfg.MetricRelabelConfigs)
+	}
+	// 缓存只作用于 HTTP 采集，后台的 history、告警和推送按各自的间隔直接采集，不计入缓存命中
+	collected := linted.Gatherer(reg)
+	scrape := collected
+	if cfg.ScrapeCacheInterval > 0 {
+		scrape = newCachingGatherer(collected, time.Duration(cfg.ScrapeCacheInterval))
+	}
+	gatherers := prometheus.Gatherers{transform(collected), meta}
+	if cfg.History.Enabled {
+		e.history.SetRetention(time.Duration(cfg.History.Retention))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.history.Record(ctx, gatherers, time.Duration(cfg.History.Interval))
+		}()
+	}
+	e.alerts.SetConfig(cfg.Alerting)
+	if len(cfg.Alerting.Rules) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.alerts.Run(ctx, gatherers)
+		}()
+	}
+	e.remote.SetConfig(cfg.RemoteWrite)
+	if cfg.RemoteWrite.Enabled() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.remote.Run(ctx, gatherers)
+		}()
+	}
+	e.otlp.SetConfig(cfg.OTLP)
+	if cfg.OTLP.Enabled() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.otlp.Run(ctx, gatherers)
+		}()
+	}
+	var inFlight chan struct{}
+	if cfg.MaxRequestsInFlight > 0 {
+		inFlight = make(chan struct{}, cfg.MaxRequestsInFlight)
+	}
+
+	old := e.state.Swap(&exporterState{
+		cfg:        cfg,
+		collectors: collectors,
+		families:   collectorFamilies(cfg.Namespace, collectors),
+		handler:    promhttp.HandlerFor(prometheus.Gatherers{transform(scrape), meta}, e.handlerOpts()),
+		scrape:     scrape,
+		meta:       meta,
+		transform:  transform,
+		inFlight:   inFlight,
+		cancel:     cancel,
+		wg:         wg,
+	})
+	if old != nil {
+		old.cancel()
+		if !reflect.DeepEqual(old.cfg.ListenConfig(), cfg.ListenConfig()) || old.cfg.TelemetryPath != cfg.TelemetryPath {
+			e.logger.Warn("Listener and telemetry_path changes take effect after a restart")
+		}
+	}
+	return old, nil
+}
+
+// Close stops the background goroutines of the active state and of the
+// collectors and waits for them to exit.
+func (e *exporter) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s := e.state.Load(); s != nil {
+		s.cancel()
+		s.wg.Wait()
+	}
+	e.collectors.close()
+}
+
+// Config returns the currently active configuration.
+func (e *exporter) Config() *config.Config {
+	return e.state.Load().cfg
+}
+
+// ServeHTTP 带 collect[] 或 exclude[] 参数时只返回选中采集器的指标
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state := e.state.Load()
+	if state.inFlight != nil {
+		select {
+		case state.inFlight <- struct{}{}:
+			defer func() { <-state.inFlight }()
+		default:
+			http.Error(w, fmt.Sprintf(
+				"Limit of concurrent requests reached (%d), try again later.", cap(state.inFlight),
+			), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	include, exclude := r.URL.Query()["collect[]"], r.URL.Query()["exclude[]"]
+	if len(include) == 0 && len(exclude) == 0 {
+		state.handler.ServeHTTP(w, r)
+		return
+	}
+	selected, err := state.selectCollectors(include, exclude)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	g := prometheus.Gatherers{state.transform(state.filteredGatherer(selected)), state.meta}
+	promhttp.HandlerFor(g, e.handlerOpts()).ServeHTTP(w, r)
+}
+
+// historyHandler 在未开启 history 时返回 404
+func (e *exporter) historyHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !e.state.Load().cfg.History.Enabled {
+			http.NotFound(w, r)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// reloadHandler 处理 POST /-/reload
+func (e *exporter) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := e.Reload(); err != nil {
+		e.logger.Error("Error reloading config", "err", err)
+		http.Error(w, "failed to reload config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	e.logger.Info("Config reloaded", "trigger", "http")
+}
+
+// watchReloads 收到 SIGHUP 时重载配置
+func (e *exporter) watchReloads(ctx context.Context, hup <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		start := time.Now()
+		if err := e.Reload(); err != nil {
+			e.logger.Error("Error reloading config", "err", err)
+			continue
+		}
+		e.logger.Info("Config reloaded", "trigger", "SIGHUP", "duration", time.Since(start))
+	}
+}
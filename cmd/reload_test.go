@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestExporter 写入配置文件并完成首次加载，kmsg 读取临时文件
+func newTestExporter(t *testing.T, cfg string) (*exporter, string) {
+	t.Helper()
+	dir := t.TempDir()
+	kmsg := filepath.Join(dir, "kmsg")
+	if err := os.WriteFile(kmsg, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "config.yml")
+	writeConfig(t, file, cfg+"\n    path: "+kmsg+"\n")
+	e := newExporter(context.Background(), file, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := e.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	return e, kmsg
+}
+
+func writeConfig(t *testing.T, file, cfg string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const reloadTestConfig = `
+namespace: %s
+collectors:
+  loadavg:
+    enabled: true
+  timex:
+    enabled: false
+  utmp:
+    enabled: false
+  kmsg:
+    enabled: true`
+
+func TestReloadSwapsState(t *testing.T) {
+	e, kmsg := newTestExporter(t, fmtConfig("first"))
+	old := e.state.Load()
+
+	writeConfig(t, e.configFile, fmtConfig("second")+"\n    path: "+kmsg+"\n")
+	if err := e.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	state := e.state.Load()
+	if state == old {
+		t.Fatal("state was not replaced")
+	}
+	if got := e.Config().Namespace; got != "second" {
+		t.Errorf("namespace = %q, want second", got)
+	}
+	if got := testutil.ToFloat64(e.reloadSuccess); got != 1 {
+		t.Errorf("exporter_config_last_reload_successful = %v, want 1", got)
+	}
+	// 设置未变的采集器沿用同一实例，kmsg 计数不会被重置
+	for i, ic := range state.collectors {
+		if ic != old.collectors[i] {
+			t.Errorf("collector %s was rebuilt although its settings did not change", ic.Name)
+		}
+	}
+}
+
+func TestReloadRebuildsChangedCollector(t *testing.T) {
+	e, _ := newTestExporter(t, fmtConfig("stathe"))
+	old := e.state.Load()
+
+	other := filepath.Join(t.TempDir(), "kmsg")
+	if err := os.WriteFile(other, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, e.configFile, fmtConfig("stathe")+"\n    path: "+other+"\n")
+	if err := e.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	state := e.state.Load()
+	for i, ic := range state.collectors {
+		changed := ic != old.collectors[i]
+		if want := ic.Name == "kmsg"; changed != want {
+			t.Errorf("collector %s rebuilt = %v, want %v", ic.Name, changed, want)
+		}
+	}
+}
+
+func TestReloadFailureKeepsOldState(t *testing.T) {
+	e, _ := newTestExporter(t, fmtConfig("stathe"))
+	old := e.state.Load()
+
+	writeConfig(t, e.configFile, "namespace: [")
+	if err := e.Reload(); err == nil {
+		t.Fatal("expected an error for invalid YAML")
+	}
+	if e.state.Load() != old {
+		t.Error("state was replaced by a failed reload")
+	}
+	if got := testutil.ToFloat64(e.reloadSuccess); got != 0 {
+		t.Errorf("exporter_config_last_reload_successful = %v, want 0", got)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	e, kmsg := newTestExporter(t, fmtConfig("stathe"))
+
+	for _, tc := range []struct {
+		method string
+		config string
+		want   int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, fmtConfig("other") + "\n    path: " + kmsg + "\n", http.StatusOK},
+		{http.MethodPost, "namespace: [", http.StatusInternalServerError},
+	} {
+		if tc.config != "" {
+			writeConfig(t, e.configFile, tc.config)
+		}
+		w := httptest.NewRecorder()
+		e.reloadHandler(w, httptest.NewRequest(tc.method, "/-/reload", nil))
+		if w.Code != tc.want {
+			t.Errorf("%s /-/reload = %d, want %d: %s", tc.method, w.Code, tc.want, w.Body)
+		}
+	}
+	if got := e.Config().Namespace; got != "other" {
+		t.Errorf("namespace = %q, want the one from the last successful reload", got)
+	}
+}
+
+func fmtConfig(namespace string) string {
+	return fmt.Sprintf(reloadTestConfig, namespace)
+}
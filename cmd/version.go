@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+)
+
+// 构建信息通过 ldflags 注入 github.com/prometheus/common/version，见 Makefile
+const programName = "exporter"
+
+// newBuildInfo 返回值恒为 1 的 exporter_build_info，标签为构建信息
+func newBuildInfo() prometheus.Gauge {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "exporter_build_info",
+		Help: "A metric with a constant '1' value labeled by version, revision, branch, build user, build date and goversion from which the exporter was built.",
+		ConstLabels: prometheus.Labels{
+			"version":    version.Version,
+			"revision":   version.GetRevision(),
+			"branch":     version.Branch,
+			"build_user": version.BuildUser,
+			"build_date": version.BuildDate,
+			"goversion":  version.GoVersion,
+		},
+	})
+	g.Set(1)
+	return g
+}
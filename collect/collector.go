@@ -1,47 +1,122 @@
 package collect
 
 import (
+	"context"
 	"fmt"
-	"net/http"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// 定义一个指标来存储系统负载
-var loadAvg = prometheus.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Name:      "system_load_average",
-		Namespace: "stathe",
-		Help:      "System 1m/5m/15m load average",
-	},
-	[]string{"time_linux"})
+// Config 为各采集器的开关和参数，对应配置文件中的 collectors 段
+type Config struct {
+	Loadavg LoadavgConfig `yaml:"loadavg"`
+	Timex   TimexConfig   `yaml:"timex"`
+	Utmp    UtmpConfig    `yaml:"utmp"`
+	Kmsg    KmsgConfig    `yaml:"kmsg"`
+}
+
+type LoadavgConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type TimexConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type UtmpConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+}
+
+type KmsgConfig struct {
+	Enabled bool       `yaml:"enabled"`
+	Path    string     `yaml:"path"`
+	Rules   []KmsgRule `yaml:"rules"`
+}
+
+// DefaultConfig kmsg 需要显式开启，timex 只在 Linux 上默认开启，其余默认开启
+var DefaultConfig = Config{
+	Loadavg: LoadavgConfig{Enabled: true},
+	Timex:   TimexConfig{Enabled: timexSupported},
+	Utmp:    UtmpConfig{Enabled: true, Path: "/var/run/utmp"},
+	Kmsg:    KmsgConfig{Path: "/dev/kmsg"},
+}
 
-// 初始化指标
-func init() {
-	prometheus.MustRegister(loadAvg)
+// Runner is implemented by collectors that need a background goroutine.
+type Runner interface {
+	Run(ctx context.Context) error
 }
 
-// HTTP 处理函数
-func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+// Settings returns the settings of every enabled collector keyed by name.
+// Collectors built from equal settings behave the same, so callers can keep
+// a running collector across config reloads while its settings are unchanged.
+func Settings(cfg Config) map[string]any {
+	s := make(map[string]any)
+	if cfg.Loadavg.Enabled {
+		s["loadavg"] = cfg.Loadavg
+	}
+	if cfg.Timex.Enabled {
+		s["timex"] = cfg.Timex
+	}
+	if cfg.Utmp.Enabled {
+		s["utmp"] = cfg.Utmp
+	}
+	if cfg.Kmsg.Enabled {
+		s["kmsg"] = cfg.Kmsg
+	}
+	return s
+}
 
+// NewCollector builds the collector name from cfg. Metric names are not
+// namespaced, callers add the namespace when registering.
+func NewCollector(name string, cfg Config) (prometheus.Collector, error) {
+	switch name {
+	case "loadavg":
+		return NewLoadavgCollector(), nil
+	case "timex":
+		c, err := NewTimexCollector()
+		if err != nil {
+			return nil, fmt.Errorf("timex: %w", err)
+		}
+		return c, nil
+	case "utmp":
+		return NewUtmpCollector(cfg.Utmp.Path), nil
+	case "kmsg":
+		c, err := NewKmsgCollector(cfg.Kmsg.Path, cfg.Kmsg.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("kmsg: %w", err)
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown collector %q", name)
+}
+
+// loadavgCollector 在每次采集时读取系统负载
+type loadavgCollector struct {
+	loadAvg *prometheus.Desc
+}
+
+// NewLoadavgCollector returns a collector exporting /proc/loadavg.
+func NewLoadavgCollector() prometheus.Collector {
+	return &loadavgCollector{
+		loadAvg: prometheus.NewDesc(
+			"system_load_average",
+			"System 1m/5m/15m load average",
+			[]string{"time_linux"}, nil),
+	}
+}
+
+func (c *loadavgCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.loadAvg
+}
+
+func (c *loadavgCollector) Collect(ch chan<- prometheus.Metric) {
 	loads, err := GetLoad()
 	if err != nil {
-		http.Error(w, "Failed to get load average", http.StatusInternalServerError)
+		ch <- prometheus.NewInvalidMetric(c.loadAvg, fmt.Errorf("failed to get load average: %w", err))
 		return
 	}
-	for i, load := range loads {
-		switch i {
-		case 0:
-			loadAvg.With(prometheus.Labels{"time_linux": fmt.Sprint("1m")}).Set(load)
-
-		case 1:
-			loadAvg.With(prometheus.Labels{"time_linux": fmt.Sprint("5m")}).Set(load)
-
-		case 2:
-			loadAvg.With(prometheus.Labels{"time_linux": fmt.Sprint("15m")}).Set(load)
-		}
+	for i, period := range []string{"1m", "5m", "15m"} {
+		ch <- prometheus.MustNewConstMetric(c.loadAvg, prometheus.GaugeValue, loads[i], period)
 	}
-	h := promhttp.Handler()
-	h.ServeHTTP(w, r)
 }
@@ -0,0 +1,170 @@
+package collect
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// KmsgRule 把匹配 Pattern 的内核日志计入 Category
+type KmsgRule struct {
+	Category string `yaml:"category"`
+	Pattern  string `yaml:"pattern"`
+}
+
+// DefaultKmsgRules 覆盖常见的内核故障事件
+var DefaultKmsgRules = []KmsgRule{
+	{Category: "oom_kill", Pattern: `Killed process \d+`},
+	{Category: "hung_task", Pattern: `blocked for more than \d+ seconds`},
+	{Category: "soft_lockup", Pattern: `soft lockup - CPU#\d+ stuck`},
+	{Category: "segfault", Pattern: `segfault at [0-9a-f]+`},
+	{Category: "io_error", Pattern: `I/O error`},
+}
+
+type kmsgMatcher struct {
+	KmsgRule
+	re *regexp.Regexp
+}
+
+// KmsgCollector 跟踪 /dev/kmsg 并按规则统计内核事件
+type KmsgCollector struct {
+	path   string
+	rules  []kmsgMatcher
+	events *prometheus.CounterVec
+	desc   *prometheus.Desc // 仅用于上报读取错误
+
+	mu  sync.Mutex
+	err error // Run 打开或读取日志失败的原因
+}
+
+// NewKmsgCollector returns a collector following path, /dev/kmsg in production
+// or a plain file when testing. Call Run to start following.
+func NewKmsgCollector(path string, rules []KmsgRule) (*KmsgCollector, error) {
+	if len(rules) == 0 {
+		rules = DefaultKmsgRules
+	}
+	c := &KmsgCollector{
+		path: path,
+		events: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: "kmsg",
+				Name:      "events_total",
+				Help:      "Kernel log messages matching a rule, by category and pattern.",
+			},
+			[]string{"category", "pattern"}),
+		desc: prometheus.NewDesc("kmsg_events_total",
+			"Kernel log messages matching a rule, by category and pattern.",
+			[]string{"category", "pattern"}, nil),
+	}
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("could not compile kmsg rule %s: %w", r.Category, err)
+		}
+		c.rules = append(c.rules, kmsgMatcher{r, re})
+		// 预先创建序列，未发生事件时也导出 0
+		c.events.WithLabelValues(r.Category, r.Pattern)
+	}
+	return c, nil
+}
+
+func (c *KmsgCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.events.Describe(ch)
+}
+
+// Collect 在 Run 失败后仍导出已有计数，同时通过 invalid metric 让采集被标记为失败
+func (c *KmsgCollector) Collect(ch chan<- prometheus.Metric) {
+	c.events.Collect(ch)
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, fmt.Errorf("failed to read %s: %w", c.path, err))
+	}
+}
+
+// Run follows the log until ctx is cancelled. An error that stops it is
+// also reported by every later Collect.
+func (c *KmsgCollector) Run(ctx context.Context) error {
+	err := c.follow(ctx)
+	if err != nil {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *KmsgCollector) follow(ctx context.Context) error {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	device := fi.Mode()&os.ModeCharDevice != 0
+	if device {
+		// 跳过启动前已存在的环形缓冲区内容，只统计新事件
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+		// 读 /dev/kmsg 会阻塞，只能通过关闭文件来打断
+		stop := context.AfterFunc(ctx, func() { f.Close() })
+		defer stop()
+	}
+
+	r := bufio.NewReaderSize(f, 8192)
+	var partial string
+	for {
+		line, err := r.ReadString('\n')
+		partial += line
+		switch {
+		case err == nil:
+			c.match(partial)
+			partial = ""
+		case errors.Is(err, syscall.EPIPE):
+			// 记录在读取前被覆盖，继续读下一条
+		case err == io.EOF && !device:
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second):
+			}
+		default:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// /dev/kmsg 每条记录形如 "6,339,5140900,-;message"，以空格开头的是续行
+func (c *KmsgCollector) match(line string) {
+	line = strings.TrimSuffix(line, "\n")
+	if strings.HasPrefix(line, " ") {
+		return
+	}
+	if header, msg, ok := strings.Cut(line, ";"); ok && strings.Count(header, ",") >= 3 {
+		line = msg
+	}
+	for _, r := range c.rules {
+		if r.re.MatchString(line) {
+			c.events.WithLabelValues(r.Category, r.Pattern).Inc()
+		}
+	}
+}
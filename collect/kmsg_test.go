@@ -0,0 +1,71 @@
+package collect
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestKmsgCollectorFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kmsg")
+	lines := []string{
+		"3,1001,5140900,-;Out of memory: Killed process 4242 (java)",
+		" SUBSYSTEM=memory",
+		"6,1002,5140901,-;eth0: link up",
+		"3,1003,5140902,-;INFO: task kworker:12 blocked for more than 120 seconds.",
+		"4,1004,5140903,-;app[77]: segfault at 0 ip 00007f sp 00007f error 4",
+		"3,1005,5140904,-;Killed process 4243 (python)",
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewKmsgCollector(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	want := map[string]float64{"oom_kill": 2, "hung_task": 1, "segfault": 1, "soft_lockup": 0, "io_error": 0}
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(c.events.WithLabelValues("oom_kill", `Killed process \d+`)) < want["oom_kill"] {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for kmsg lines to be counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() = %v, want nil after cancel", err)
+	}
+
+	for _, r := range DefaultKmsgRules {
+		if got := testutil.ToFloat64(c.events.WithLabelValues(r.Category, r.Pattern)); got != want[r.Category] {
+			t.Errorf("%s = %v, want %v", r.Category, got, want[r.Category])
+		}
+	}
+}
+
+func TestKmsgCollectorOpenError(t *testing.T) {
+	c, err := NewKmsgCollector(filepath.Join(t.TempDir(), "missing"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err == nil {
+		t.Fatal("Run() = nil, want error for missing file")
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	if _, err := reg.Gather(); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Gather() error = %v, want the open error", err)
+	}
+}
@@ -0,0 +1,119 @@
+package collect
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Status 为采集器最近一次采集的结果
+type Status struct {
+	LastScrape time.Time
+	Duration   time.Duration
+	Err        error
+}
+
+// Success reports whether the last scrape produced no invalid metrics.
+func (s Status) Success() bool {
+	return !s.LastScrape.IsZero() && s.Err == nil
+}
+
+// errorLogInterval 为持续失败的采集器两次错误日志之间的最短间隔
+const errorLogInterval = 5 * time.Minute
+
+// Instrumented 包装一个具名采集器，记录每次采集的耗时和是否成功
+type Instrumented struct {
+	Name string
+	prometheus.Collector
+
+	logger   *slog.Logger
+	duration *prometheus.Desc
+	success  *prometheus.Desc
+
+	mu        sync.Mutex
+	status    Status
+	lastError time.Time // 上次记录错误日志的时间
+}
+
+// Instrument wraps c so that every Collect also exports
+// scrape_collector_duration_seconds and scrape_collector_success. Failures
+// are logged at most once per errorLogInterval while a collector keeps failing.
+func Instrument(name string, c prometheus.Collector, logger *slog.Logger) *Instrumented {
+	labels := prometheus.Labels{"collector": name}
+	return &Instrumented{
+		Name:      name,
+		Collector: c,
+		logger:    logger.With("collector", name),
+		duration: prometheus.NewDesc("scrape_collector_duration_seconds",
+			"Duration of a collector scrape.", nil, labels),
+		success: prometheus.NewDesc("scrape_collector_success",
+			"Whether a collector succeeded.", nil, labels),
+	}
+}
+
+// Status returns the result of the most recent scrape.
+func (i *Instrumented) Status() Status {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.status
+}
+
+func (i *Instrumented) Describe(ch chan<- *prometheus.Desc) {
+	i.Collector.Describe(ch)
+	ch <- i.duration
+	ch <- i.success
+}
+
+func (i *Instrumented) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	inner := make(chan prometheus.Metric)
+	done := make(chan error)
+	go func() {
+		// 采集器通过 NewInvalidMetric 上报错误，这里取第一个
+		var firstErr error
+		for m := range inner {
+			if firstErr == nil {
+				if err := m.Write(&dto.Metric{}); err != nil {
+					firstErr = err
+				}
+			}
+			ch <- m
+		}
+		done <- firstErr
+	}()
+	i.Collector.Collect(inner)
+	close(inner)
+	err := <-done
+
+	status := Status{LastScrape: start, Duration: time.Since(start), Err: err}
+	i.record(status)
+
+	success := 0.0
+	if status.Success() {
+		success = 1
+	}
+	ch <- prometheus.MustNewConstMetric(i.duration, prometheus.GaugeValue, status.Duration.Seconds())
+	ch <- prometheus.MustNewConstMetric(i.success, prometheus.GaugeValue, success)
+}
+
+func (i *Instrumented) record(status Status) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	failing := i.status.Err != nil
+	i.status = status
+	switch {
+	case status.Err != nil && (!failing || time.Since(i.lastError) >= errorLogInterval):
+		i.lastError = time.Now()
+		i.logger.Error("Collector failed", "duration_seconds", status.Duration.Seconds(), "err", status.Err)
+	case status.Err != nil:
+		i.logger.Debug("Collector failed", "duration_seconds", status.Duration.Seconds(), "err", status.Err)
+	case failing:
+		i.logger.Info("Collector recovered", "duration_seconds", status.Duration.Seconds())
+	default:
+		i.logger.Debug("Collector succeeded", "duration_seconds", status.Duration.Seconds())
+	}
+}
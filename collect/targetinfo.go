@@ -0,0 +1,62 @@
+package collect
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// TargetInfoConfig 配置 target_info 指标携带的主机标识
+type TargetInfoConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	MachineIDFile string `yaml:"machine_id_file"`
+	// EnvLabels 把环境变量作为标签，如 node_name: NODE_NAME，未设置的变量忽略
+	EnvLabels map[string]string `yaml:"env_labels"`
+}
+
+var DefaultTargetInfoConfig = TargetInfoConfig{
+	Enabled:       true,
+	MachineIDFile: "/etc/machine-id",
+}
+
+// NewTargetInfoCollector returns the OpenMetrics target_info metric with
+// hostname, machine_id and the configured environment labels. The values
+// are read once, they identify the host for the lifetime of the process.
+func NewTargetInfoCollector(cfg TargetInfoConfig) (prometheus.Collector, error) {
+	labels := prometheus.Labels{}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	labels["hostname"] = hostname
+
+	if cfg.MachineIDFile != "" {
+		id, err := os.ReadFile(cfg.MachineIDFile)
+		// 容器里通常没有 machine-id，缺失时不加该标签
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if id := strings.TrimSpace(string(id)); id != "" {
+			labels["machine_id"] = id
+		}
+	}
+	for name, env := range cfg.EnvLabels {
+		if !model.LabelName(name).IsValid() {
+			return nil, fmt.Errorf("invalid target_info label name %q", name)
+		}
+		if v := os.Getenv(env); v != "" {
+			labels[name] = v
+		}
+	}
+
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "target_info",
+		Help:        "Target metadata.",
+		ConstLabels: labels,
+	})
+	g.Set(1)
+	return g, nil
+}
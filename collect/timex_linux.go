@@ -0,0 +1,93 @@
+package collect
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+// timexSupported 决定 timex 是否默认开启
+const timexSupported = true
+
+const (
+	// 内核 freq 字段单位为 ppm，低 16 位为小数部分
+	ppm16frac    = 1000000.0 * 65536.0
+	microSeconds = 1e-6
+	nanoSeconds  = 1e-9
+)
+
+// timexCollector 通过 adjtimex(2) 读取内核时钟同步状态
+type timexCollector struct {
+	offset,
+	freq,
+	maxerror,
+	esterror,
+	syncStatus,
+	taiOffset *prometheus.Desc
+}
+
+// NewTimexCollector returns a collector exporting the kernel clock discipline state.
+func NewTimexCollector() (prometheus.Collector, error) {
+	newDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("", "timex", name), help, nil, nil)
+	}
+	return &timexCollector{
+		offset:     newDesc("offset_seconds", "Time offset between local system and reference clock."),
+		freq:       newDesc("frequency_adjustment_ratio", "Local clock frequency adjustment."),
+		maxerror:   newDesc("maxerror_seconds", "Maximum error in seconds."),
+		esterror:   newDesc("estimated_error_seconds", "Estimated error in seconds."),
+		syncStatus: newDesc("sync_status", "Is clock synchronized to a reliable server (1 = yes, 0 = no)."),
+		taiOffset:  newDesc("tai_offset_seconds", "International Atomic Time (TAI) offset."),
+	}, nil
+}
+
+func (c *timexCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.offset
+	ch <- c.freq
+	ch <- c.maxerror
+	ch <- c.esterror
+	ch <- c.syncStatus
+	ch <- c.taiOffset
+}
+
+func (c *timexCollector) Collect(ch chan<- prometheus.Metric) {
+	var tx unix.Timex
+	status, err := unix.Adjtimex(&tx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.offset, err)
+		return
+	}
+
+	r := convertTimex(&tx, status)
+	ch <- prometheus.MustNewConstMetric(c.offset, prometheus.GaugeValue, r.offset)
+	ch <- prometheus.MustNewConstMetric(c.freq, prometheus.GaugeValue, r.freq)
+	ch <- prometheus.MustNewConstMetric(c.maxerror, prometheus.GaugeValue, r.maxerror)
+	ch <- prometheus.MustNewConstMetric(c.esterror, prometheus.GaugeValue, r.esterror)
+	ch <- prometheus.MustNewConstMetric(c.syncStatus, prometheus.GaugeValue, r.syncStatus)
+	ch <- prometheus.MustNewConstMetric(c.taiOffset, prometheus.GaugeValue, r.taiOffset)
+}
+
+// timexValues 为换算成秒和比例后的 adjtimex 结果
+type timexValues struct {
+	offset, freq, maxerror, esterror, syncStatus, taiOffset float64
+}
+
+// convertTimex 换算单位，status 为 adjtimex 的返回值
+func convertTimex(tx *unix.Timex, status int) timexValues {
+	// STA_NANO 置位时 offset 单位为纳秒，否则为微秒
+	divisor := microSeconds
+	if tx.Status&unix.STA_NANO != 0 {
+		divisor = nanoSeconds
+	}
+	syncStatus := 1.0
+	if status == unix.TIME_ERROR {
+		syncStatus = 0
+	}
+	return timexValues{
+		offset:     float64(tx.Offset) * divisor,
+		freq:       1 + float64(tx.Freq)/ppm16frac,
+		maxerror:   float64(tx.Maxerror) * microSeconds,
+		esterror:   float64(tx.Esterror) * microSeconds,
+		syncStatus: syncStatus,
+		taiOffset:  float64(tx.Tai),
+	}
+}
@@ -0,0 +1,62 @@
+package collect
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestConvertTimex(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tx     unix.Timex
+		status int
+		want   timexValues
+	}{
+		{
+			name:   "microseconds",
+			tx:     unix.Timex{Offset: 1500, Freq: 65536, Maxerror: 250000, Esterror: 16, Tai: 37},
+			status: unix.TIME_OK,
+			want:   timexValues{offset: 0.0015, freq: 1.000001, maxerror: 0.25, esterror: 0.000016, syncStatus: 1, taiOffset: 37},
+		},
+		{
+			name:   "nanoseconds",
+			tx:     unix.Timex{Status: unix.STA_NANO | unix.STA_PLL, Offset: -1500, Freq: -65536 * 500},
+			status: unix.TIME_OK,
+			want:   timexValues{offset: -0.0000015, freq: 0.9995, syncStatus: 1},
+		},
+		{
+			// freq 低 16 位为 ppm 的小数部分
+			name:   "fractional ppm",
+			tx:     unix.Timex{Freq: 32768},
+			status: unix.TIME_INS,
+			want:   timexValues{freq: 1.0000005, syncStatus: 1},
+		},
+		{
+			name:   "unsynchronized",
+			tx:     unix.Timex{Status: unix.STA_UNSYNC, Maxerror: 16000000},
+			status: unix.TIME_ERROR,
+			want:   timexValues{freq: 1, maxerror: 16, syncStatus: 0},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := convertTimex(&tc.tx, tc.status)
+			for _, f := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"offset", got.offset, tc.want.offset},
+				{"freq", got.freq, tc.want.freq},
+				{"maxerror", got.maxerror, tc.want.maxerror},
+				{"esterror", got.esterror, tc.want.esterror},
+				{"syncStatus", got.syncStatus, tc.want.syncStatus},
+				{"taiOffset", got.taiOffset, tc.want.taiOffset},
+			} {
+				if math.Abs(f.got-f.want) > 1e-12 {
+					t.Errorf("%s = %v, want %v", f.name, f.got, f.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package collect
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// timexSupported 决定 timex 是否默认开启
+const timexSupported = false
+
+// NewTimexCollector adjtimex(2) 仅在 Linux 上可用
+func NewTimexCollector() (prometheus.Collector, error) {
+	return nil, errors.New("adjtimex is only supported on linux")
+}
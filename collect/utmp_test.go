@@ -0,0 +1,82 @@
+package collect
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestReadUtmp(t *testing.T) {
+	sessions, err := ReadUtmp("testdata/utmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, line, host string
+		addr             netip.Addr
+		login            int64
+		tty, remote      string
+	}{
+		{"alice", "pts/0", "192.168.1.10", netip.MustParseAddr("192.168.1.10"), 1700000100, "pts", "private"},
+		{"bob", "pts/1", "2001:db8::1", netip.MustParseAddr("2001:db8::1"), 1700000200, "pts", "public"},
+		{"root", "tty1", "", netip.MustParseAddr("0.0.0.0"), 1700000050, "tty", "local"},
+		{"carol", "pts/2", "203.0.113.5", netip.MustParseAddr("0.0.0.0"), 1700000300, "pts", "public"},
+		{"dave", ":0", ":0", netip.MustParseAddr("0.0.0.0"), 1700000400, "x11", "local"},
+		{"eve", "pts/3", "bastion.example.com", netip.MustParseAddr("::1"), 1700000500, "pts", "loopback"},
+	}
+	// BOOT_TIME、RUN_LVL、LOGIN_PROCESS 和 DEAD_PROCESS 记录不计入
+	if len(sessions) != len(tests) {
+		t.Fatalf("got %d sessions, want %d: %+v", len(sessions), len(tests), sessions)
+	}
+	for i, tt := range tests {
+		s := sessions[i]
+		if s.User != tt.user || s.Line != tt.line || s.Host != tt.host {
+			t.Errorf("session %d = %q %q %q, want %q %q %q", i, s.User, s.Line, s.Host, tt.user, tt.line, tt.host)
+		}
+		if s.Addr != tt.addr {
+			t.Errorf("%s: addr = %v, want %v", tt.user, s.Addr, tt.addr)
+		}
+		if !s.Login.Equal(time.Unix(tt.login, 0)) {
+			t.Errorf("%s: login = %v, want %v", tt.user, s.Login, time.Unix(tt.login, 0))
+		}
+		if got := s.TTYType(); got != tt.tty {
+			t.Errorf("%s: TTYType() = %q, want %q", tt.user, got, tt.tty)
+		}
+		if got := s.RemoteClass(); got != tt.remote {
+			t.Errorf("%s: RemoteClass() = %q, want %q", tt.user, got, tt.remote)
+		}
+	}
+}
+
+func TestReadUtmpTruncated(t *testing.T) {
+	sessions, err := ReadUtmp("testdata/utmp-truncated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].User != "alice" || sessions[1].User != "bob" {
+		t.Errorf("got %+v, want the two complete records", sessions)
+	}
+}
+
+func TestRemoteClass(t *testing.T) {
+	tests := []struct {
+		host string
+		addr netip.Addr
+		want string
+	}{
+		{"", netip.Addr{}, "local"},
+		{":1", netip.Addr{}, "local"},
+		{"example.com", netip.Addr{}, "hostname"},
+		{"127.0.0.1", netip.Addr{}, "loopback"},
+		{"", netip.MustParseAddr("::ffff:10.0.0.1"), "private"},
+		{"", netip.MustParseAddr("fe80::1"), "private"},
+		{"", netip.MustParseAddr("8.8.8.8"), "public"},
+	}
+	for _, tt := range tests {
+		s := UtmpSession{Host: tt.host, Addr: tt.addr}
+		if got := s.RemoteClass(); got != tt.want {
+			t.Errorf("RemoteClass(%q, %v) = %q, want %q", tt.host, tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"exporter-demo/alert"
+	"exporter-demo/collect"
+	"exporter-demo/derive"
+	"exporter-demo/history"
+	"exporter-demo/lint"
+	"exporter-demo/otlp"
+	"exporter-demo/relabel"
+	"exporter-demo/remote"
+	"exporter-demo/web"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Config 为 exporter 的整体配置
+type Config struct {
+	ListenAddress       Addresses                `yaml:"listen_address"`
+	UnixSocketMode      string                   `yaml:"unix_socket_mode"`
+	SystemdSocket       bool                     `yaml:"systemd_socket"`
+	TelemetryPath       string                   `yaml:"telemetry_path"`
+	MaxRequestsInFlight int                      `yaml:"max_requests_in_flight"` // 0 为不限制
+	ScrapeCacheInterval model.Duration           `yaml:"scrape_cache_interval"`  // 间隔内的采集共用一次结果，0 为不缓存
+	Namespace           string                   `yaml:"namespace"`
+	ExternalLabels      map[string]string        `yaml:"external_labels"`
+	MetricLint          lint.Mode                `yaml:"metric_lint"` // off、warn 或 strict
+	TargetInfo          collect.TargetInfoConfig `yaml:"target_info"`
+	History             history.Config           `yaml:"history"`
+	Collectors          collect.Config           `yaml:"collectors"`
+	Alerting            alert.Config             `yaml:"alerting"`
+	RemoteWrite         remote.Config            `yaml:"remote_write"`
+	OTLP                otlp.Config              `yaml:"otlp"`
+	// DerivedMetrics 在每次采集时由其他指标计算得到，先于 MetricRelabelConfigs 生效
+	DerivedMetrics []*derive.Rule `yaml:"derived_metrics"`
+	// MetricRelabelConfigs 在输出前按顺序改写或过滤序列，不作用于 exporter 自身指标
+	MetricRelabelConfigs []*relabel.Config `yaml:"metric_relabel_configs"`
+}
+
+// Addresses 在配置文件中可以写成单个地址或地址列表
+type Addresses []string
+
+func (a *Addresses) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*a = Addresses{value.Value}
+		return nil
+	}
+	var addrs []string
+	if err := value.Decode(&addrs); err != nil {
+		return err
+	}
+	*a = addrs
+	return nil
+}
+
+// ListenConfig returns the listener settings for package web.
+func (c *Config) ListenConfig() web.ListenConfig {
+	mode, _ := strconv.ParseUint(c.UnixSocketMode, 8, 32)
+	return web.ListenConfig{
+		Addresses:      c.ListenAddress,
+		UnixSocketMode: os.FileMode(mode),
+		SystemdSocket:  c.SystemdSocket,
+	}
+}
+
+// Default returns the configuration used when no config file is given.
+func Default() *Config {
+	cfg := &Config{
+		ListenAddress:       Addresses{":8080"},
+		UnixSocketMode:      "0660",
+		TelemetryPath:       "/metrics",
+		MaxRequestsInFlight: 40,
+		Namespace:           "stathe",
+		MetricLint:          lint.Warn,
+		ExternalLabels:      map[string]string{},
+		TargetInfo:          collect.DefaultTargetInfoConfig,
+		History:             history.DefaultConfig,
+		Alerting:            alert.DefaultConfig,
+		RemoteWrite:         remote.DefaultConfig,
+		OTLP:                otlp.DefaultConfig,
+		Collectors:          collect.DefaultConfig,
+	}
+	cfg.Collectors.Kmsg.Rules = append([]collect.KmsgRule(nil), collect.DefaultKmsgRules...)
+	return cfg
+}
+
+// LoadFile parses and validates a YAML config file on top of the defaults.
+func LoadFile(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return cfg, nil
+}
+
+// Load parses and validates YAML config data. Errors carry the line they
+// refer to, e.g. "line 12: invalid namespace".
+func Load(data []byte) (*Config, error) {
+	cfg := Default()
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := cfg.validate(&root); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+var namespaceRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (c *Config) validate(root *yaml.Node) error {
+	if len(c.ListenAddress) == 0 && !c.SystemdSocket {
+		return lineError(root, []string{"listen_address"}, "listen_address must not be empty")
+	}
+	for i, addr := range c.ListenAddress {
+		if err := web.ValidateAddress(addr); err != nil {
+			return lineError(root, []string{"listen_address", strconv.Itoa(i)}, "invalid listen_address %q: %v", addr, err)
+		}
+	}
+	if _, err := strconv.ParseUint(c.UnixSocketMode, 8, 32); err != nil {
+		return lineError(root, []string{"unix_socket_mode"}, "invalid unix_socket_mode %q, want an octal file mode", c.UnixSocketMode)
+	}
+	if !strings.HasPrefix(c.TelemetryPath, "/") {
+		return lineError(root, []string{"telemetry_path"}, "telemetry_path %q must start with /", c.TelemetryPath)
+	}
+	if c.MaxRequestsInFlight < 0 {
+		return lineError(root, []string{"max_requests_in_flight"}, "max_requests_in_flight must not be negative")
+	}
+	if c.ScrapeCacheInterval < 0 {
+		return lineError(root, []string{"scrape_cache_interval"}, "scrape_cache_interval must not be negative")
+	}
+	if c.Namespace != "" && !namespaceRE.MatchString(c.Namespace) {
+		return lineError(root, []string{"namespace"}, "invalid namespace %q", c.Namespace)
+	}
+	switch c.MetricLint {
+	case lint.Off, lint.Warn, lint.Strict:
+	default:
+		return lineError(root, []string{"metric_lint"}, "invalid metric_lint %q, want off, warn or strict", c.MetricLint)
+	}
+	for name := range c.ExternalLabels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+			return lineError(root, []string{"external_labels", name}, "invalid external label name %q", name)
+		}
+		// 外部标签也会加到 target_info 上，不能与它自带的标签重名
+		if _, ok := c.TargetInfo.EnvLabels[name]; c.TargetInfo.Enabled && (ok || name == "hostname" || name == "machine_id") {
+			return lineError(root, []string{"external_labels", name}, "external label %q is already used by target_info", name)
+		}
+	}
+	for name := range c.TargetInfo.EnvLabels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+			return lineError(root, []string{"target_info", "env_labels", name}, "invalid target_info label name %q", name)
+		}
+		if _, ok := c.ExternalLabels[name]; ok || name == "hostname" || name == "machine_id" {
+			return lineError(root, []string{"target_info", "env_labels", name}, "target_info label %q is already used", name)
+		}
+	}
+	if c.History.Enabled && c.History.Interval <= 0 {
+		return lineError(root, []string{"history", "interval"}, "history interval must be positive")
+	}
+	if c.History.Enabled && c.History.Retention < c.History.Interval {
+		return lineError(root, []string{"history", "retention"}, "history retention must not be shorter than the interval")
+	}
+	names := make(map[string]bool)
+	for i, r := range c.DerivedMetrics {
+		path := []string{"derived_metrics", strconv.Itoa(i)}
+		if err := r.Validate(); err != nil {
+			return lineError(root, path, "%v", err)
+		}
+		if names[r.Name] {
+			return lineError(root, append(path, "name"), "duplicate derived metric %q", r.Name)
+		}
+		names[r.Name] = true
+	}
+	if err := c.Alerting.Validate(); err != nil {
+		return lineError(root, []string{"alerting"}, "%v", err)
+	}
+	alertNames := make(map[string]bool)
+	for i, r := range c.Alerting.Rules {
+		path := []string{"alerting", "rules", strconv.Itoa(i)}
+		if err := r.Validate(); err != nil {
+			return lineError(root, path, "%v", err)
+		}
+		if alertNames[r.Alert] {
+			return lineError(root, append(path, "alert"), "duplicate alert rule %q", r.Alert)
+		}
+		alertNames[r.Alert] = true
+	}
+	if err := c.RemoteWrite.Validate(); err != nil {
+		return lineError(root, []string{"remote_write"}, "%v", err)
+	}
+	if err := c.OTLP.Validate(); err != nil {
+		return lineError(root, []string{"otlp"}, "%v", err)
+	}
+
+	cs := c.Collectors
+	if cs.Utmp.Enabled && cs.Utmp.Path == "" {
+		return lineError(root, []string{"collectors", "utmp"}, "utmp collector needs a path")
+	}
+	if cs.Kmsg.Enabled && cs.Kmsg.Path == "" {
+		return lineError(root, []string{"collectors", "kmsg"}, "kmsg collector needs a path")
+	}
+	for i, r := range cs.Kmsg.Rules {
+		path := []string{"collectors", "kmsg", "rules", strconv.Itoa(i)}
+		if r.Category == "" {
+			return lineError(root, path, "kmsg rule needs a category")
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return lineError(root, append(path, "pattern"), "invalid kmsg pattern: %v", err)
+		}
+	}
+	return nil
+}
+
+func lineError(root *yaml.Node, path []string, format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", lineOf(root, path...), fmt.Sprintf(format, args...))
+}
+
+// lineOf returns the line of the node at path, or of its deepest existing
+// parent when the key is absent from the file.
+func lineOf(n *yaml.Node, path ...string) int {
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	line := n.Line
+	for _, key := range path {
+		var next *yaml.Node
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == key {
+					line, next = n.Content[i].Line, n.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i < len(n.Content) {
+				next = n.Content[i]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	return line
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"exporter-demo/collect"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadExample(t *testing.T) {
+	cfg, err := LoadFile("example.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.ListenAddress) != 2 || cfg.Namespace != "stathe" || cfg.ExternalLabels["role"] != "web" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if len(cfg.DerivedMetrics) != 3 || len(cfg.Alerting.Rules) != 2 || len(cfg.MetricRelabelConfigs) != 3 {
+		t.Errorf("got %d derived metrics, %d alert rules, %d relabel configs",
+			len(cfg.DerivedMetrics), len(cfg.Alerting.Rules), len(cfg.MetricRelabelConfigs))
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load([]byte("namespace: demo\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Namespace != "demo" || cfg.TelemetryPath != "/metrics" || cfg.ListenAddress[0] != ":8080" {
+		t.Errorf("defaults not applied: %+v", cfg)
+	}
+	if cfg.Collectors.Utmp.Path != collect.DefaultConfig.Utmp.Path || len(cfg.Collectors.Kmsg.Rules) != len(collect.DefaultKmsgRules) {
+		t.Errorf("collector defaults not applied: %+v", cfg.Collectors)
+	}
+
+	// 单个地址可以写成标量
+	cfg, err = Load([]byte("listen_address: unix:/tmp/e.sock\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.ListenAddress) != 1 || cfg.ListenAddress[0] != "unix:/tmp/e.sock" {
+		t.Errorf("ListenAddress = %v", cfg.ListenAddress)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"unknown field", "namespace: a\nbogus: 1\n", "line 2: field bogus not found"},
+		{"namespace", "telemetry_path: /m\nnamespace: 1a\n", `line 2: invalid namespace "1a"`},
+		{"telemetry path", "telemetry_path: metrics\n", "line 1: telemetry_path"},
+		{"listen address index", "listen_address:\n  - \":8080\"\n  - \"bad\"\n", `line 3: invalid listen_address "bad"`},
+		{"external label", "external_labels:\n  ok: a\n  __bad: b\n", `line 3: invalid external label name "__bad"`},
+		{"external label hostname", "external_labels:\n  role: web\n  hostname: a\n", `line 3: external label "hostname" is already used by target_info`},
+		{"external label env", "target_info:\n  env_labels:\n    node: NODE\nexternal_labels:\n  node: a\n", `line 5: external label "node" is already used by target_info`},
+		{"kmsg pattern", "collectors:\n  kmsg:\n    rules:\n      - category: x\n        pattern: '('\n", "line 5: invalid kmsg pattern"},
+		{"kmsg category", "collectors:\n  kmsg:\n    rules:\n      - pattern: x\n", "line 4: kmsg rule needs a category"},
+		// 出错的键不在文件中时，报告最近的父节点所在行
+		{"absent key", "namespace: a\ncollectors:\n  utmp:\n    enabled: true\n    path: ''\n", "line 3: utmp collector needs a path"},
+		{"metric lint", "metric_lint: loud\n", `line 1: invalid metric_lint "loud"`},
+		{"history", "history:\n  enabled: true\n  interval: 1m\n  retention: 30s\n", "line 4: history retention"},
+		{"duplicate derived metric", "derived_metrics:\n  - name: a\n    expr: up\n  - name: a\n    expr: up\n", `line 4: duplicate derived metric "a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineOf(t *testing.T) {
+	var root yaml.Node
+	doc := "a:\n  b:\n    - x\n    - y\n  c: 1\n"
+	if err := yaml.Unmarshal([]byte(doc), &root); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path []string
+		want int
+	}{
+		{nil, 1},
+		{[]string{"a"}, 1},
+		{[]string{"a", "c"}, 5},
+		{[]string{"a", "b", "1"}, 4},
+		{[]string{"a", "b", "7"}, 2},
+		{[]string{"a", "missing", "x"}, 1},
+	}
+	for _, tt := range tests {
+		if got := lineOf(&root, tt.path...); got != tt.want {
+			t.Errorf("lineOf(%v) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
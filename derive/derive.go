@@ -0,0 +1,189 @@
+// Package derive computes derived series from gathered metrics at scrape
+// time, for consumers that cannot run recording rules.
+package derive
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule 定义一个派生指标，结果以 gauge 导出
+type Rule struct {
+	Name string `yaml:"name"`
+	Help string `yaml:"help,omitempty"`
+	Expr Expr   `yaml:"expr"`
+}
+
+// Expr 为解析后的表达式，保留原文用于输出配置
+type Expr struct {
+	Node
+	original string
+}
+
+func ParseExpr(s string) (Expr, error) {
+	n, err := Parse(s)
+	return Expr{Node: n, original: s}, err
+}
+
+func (e *Expr) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	expr, err := ParseExpr(s)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid expr %q: %w", value.Line, s, err)
+	}
+	*e = expr
+	return nil
+}
+
+func (e Expr) MarshalYAML() (any, error) {
+	return e.original, nil
+}
+
+// Eval evaluates the expression on samples. A scalar result becomes a
+// single series without labels.
+func (e Expr) Eval(samples model.Vector) (model.Vector, error) {
+	s, v, err := e.eval(samples)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		v = model.Vector{{Metric: model.Metric{}, Value: model.SampleValue(s)}}
+	}
+	return v, nil
+}
+
+// IsScalar reports whether the expression evaluates to a scalar, i.e. it
+// selects no series.
+func (e Expr) IsScalar() bool {
+	return isScalar(e.Node)
+}
+
+func isScalar(n Node) bool {
+	switch n := n.(type) {
+	case numberLiteral:
+		return true
+	case *binaryExpr:
+		return isScalar(n.lhs) && isScalar(n.rhs)
+	}
+	return false
+}
+
+func (e Expr) String() string {
+	return e.original
+}
+
+// Validate checks the rule name; the expression was checked when parsed.
+func (r *Rule) Validate() error {
+	if !model.IsValidMetricName(model.LabelValue(r.Name)) {
+		return fmt.Errorf("invalid derived metric name %q", r.Name)
+	}
+	if r.Expr.Node == nil {
+		return fmt.Errorf("derived metric %s needs an expr", r.Name)
+	}
+	return nil
+}
+
+// Eval evaluates the rule on samples into a gauge family.
+func (r *Rule) Eval(samples model.Vector) (*dto.MetricFamily, error) {
+	v, err := r.Expr.Eval(samples)
+	if err != nil {
+		return nil, err
+	}
+
+	help := r.Help
+	if help == "" {
+		help = "Derived from " + r.Expr.original
+	}
+	mf := &dto.MetricFamily{Name: proto.String(r.Name), Help: proto.String(help), Type: dto.MetricType_GAUGE.Enum()}
+	seen := make(map[model.Fingerprint]bool)
+	for _, smpl := range v {
+		fp := smpl.Metric.Fingerprint()
+		if seen[fp] {
+			return nil, fmt.Errorf("result has duplicate series %s", smpl.Metric)
+		}
+		seen[fp] = true
+		m := &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(float64(smpl.Value))}}
+		for name, value := range smpl.Metric {
+			if name == model.MetricNameLabel {
+				continue
+			}
+			m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(string(name)), Value: proto.String(string(value))})
+		}
+		sort.Slice(m.Label, func(i, j int) bool { return m.Label[i].GetName() < m.Label[j].GetName() })
+		mf.Metric = append(mf.Metric, m)
+	}
+	sort.Slice(mf.Metric, func(i, j int) bool { return labelsLess(mf.Metric[i].Label, mf.Metric[j].Label) })
+	return mf, nil
+}
+
+func labelsLess(a, b []*dto.LabelPair) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].GetName() != b[i].GetName() {
+			return a[i].GetName() < b[i].GetName()
+		}
+		if a[i].GetValue() != b[i].GetValue() {
+			return a[i].GetValue() < b[i].GetValue()
+		}
+	}
+	return len(a) < len(b)
+}
+
+// Gatherer wraps g and appends the series of rules to every Gather. Rules
+// are evaluated in order and can use the results of earlier rules. A rule
+// that fails is skipped and its error returned alongside the other metrics.
+func Gatherer(g prometheus.Gatherer, rules []*Rule) prometheus.Gatherer {
+	if len(rules) == 0 {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		errs := []error{err}
+		// mfs 可能来自缓存，不能原地追加或排序
+		mfs = slices.Clone(mfs)
+
+		names := make(map[string]bool, len(mfs))
+		for _, mf := range mfs {
+			names[mf.GetName()] = true
+		}
+		samples, err := expfmt.ExtractSamples(&expfmt.DecodeOptions{Timestamp: model.Now()}, mfs...)
+		errs = append(errs, err)
+
+		for _, r := range rules {
+			if names[r.Name] {
+				errs = append(errs, fmt.Errorf("derived metric %s: a metric with this name already exists", r.Name))
+				continue
+			}
+			mf, err := r.Eval(samples)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("derived metric %s: %w", r.Name, err))
+				continue
+			}
+			if len(mf.Metric) == 0 {
+				continue
+			}
+			names[r.Name] = true
+			mfs = append(mfs, mf)
+			for _, m := range mf.Metric {
+				metric := model.Metric{model.MetricNameLabel: model.LabelValue(r.Name)}
+				for _, lp := range m.Label {
+					metric[model.LabelName(lp.GetName())] = model.LabelValue(lp.GetValue())
+				}
+				samples = append(samples, &model.Sample{Metric: metric, Value: model.SampleValue(m.Gauge.GetValue())})
+			}
+		}
+		sort.Slice(mfs, func(i, j int) bool { return mfs[i].GetName() < mfs[j].GetName() })
+		return mfs, errors.Join(errs...)
+	})
+}
@@ -0,0 +1,266 @@
+package derive
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"exporter-demo/labels"
+
+	"github.com/prometheus/common/model"
+)
+
+// Node 为表达式语法树的节点
+type Node interface {
+	// eval 返回标量（vector 为 nil）或向量
+	eval(in model.Vector) (scalar float64, vector model.Vector, err error)
+}
+
+type numberLiteral float64
+
+func (n numberLiteral) eval(model.Vector) (float64, model.Vector, error) {
+	return float64(n), nil, nil
+}
+
+type selector struct {
+	matchers []*labels.Matcher
+}
+
+func (s *selector) eval(in model.Vector) (float64, model.Vector, error) {
+	out := model.Vector{}
+	for _, smpl := range in {
+		if labels.MatchesAll(smpl.Metric, s.matchers) {
+			out = append(out, smpl)
+		}
+	}
+	return 0, out, nil
+}
+
+type binaryExpr struct {
+	op       string
+	lhs, rhs Node
+	on       bool // 为 true 时只按 matching 中的标签匹配，否则忽略这些标签
+	matching []model.LabelName
+}
+
+// comparisons 过滤向量，只保留条件成立的序列，与不带 bool 的 PromQL 比较相同
+var comparisons = []string{"==", "!=", ">", "<", ">=", "<="}
+
+func compare(op string, a, b float64) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	}
+	return false
+}
+
+func arith(op string, a, b float64) float64 {
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		return a / b
+	}
+	return math.NaN()
+}
+
+func (b *binaryExpr) eval(in model.Vector) (float64, model.Vector, error) {
+	ls, lv, err := b.lhs.eval(in)
+	if err != nil {
+		return 0, nil, err
+	}
+	rs, rv, err := b.rhs.eval(in)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if slices.Contains(comparisons, b.op) {
+		return b.filter(ls, lv, rs, rv)
+	}
+	switch {
+	case lv == nil && rv == nil:
+		return arith(b.op, ls, rs), nil, nil
+	case rv == nil:
+		return 0, mapVector(lv, func(v float64) float64 { return arith(b.op, v, rs) }), nil
+	case lv == nil:
+		return 0, mapVector(rv, func(v float64) float64 { return arith(b.op, ls, v) }), nil
+	}
+
+	// 两个向量按标签一对一匹配，与 PromQL 相同
+	rhs := make(map[model.Fingerprint]*model.Sample, len(rv))
+	for _, smpl := range rv {
+		sig := b.signature(smpl.Metric).Fingerprint()
+		if _, ok := rhs[sig]; ok {
+			return 0, nil, fmt.Errorf("found duplicate series for the match group %s on the right hand-side of the operation", b.signature(smpl.Metric))
+		}
+		rhs[sig] = smpl
+	}
+	out := model.Vector{}
+	matched := make(map[model.Fingerprint]bool)
+	for _, smpl := range lv {
+		sig := b.signature(smpl.Metric)
+		r, ok := rhs[sig.Fingerprint()]
+		if !ok {
+			continue
+		}
+		if matched[sig.Fingerprint()] {
+			return 0, nil, fmt.Errorf("found duplicate series for the match group %s on the left hand-side of the operation", sig)
+		}
+		matched[sig.Fingerprint()] = true
+
+		metric := sig
+		if !b.on {
+			metric = dropName(smpl.Metric)
+			for _, name := range b.matching {
+				delete(metric, name)
+			}
+		}
+		out = append(out, &model.Sample{Metric: metric, Value: model.SampleValue(arith(b.op, float64(smpl.Value), float64(r.Value)))})
+	}
+	return 0, out, nil
+}
+
+// filter 保留比较成立的序列，结果取向量一侧的值和标签
+func (b *binaryExpr) filter(ls float64, lv model.Vector, rs float64, rv model.Vector) (float64, model.Vector, error) {
+	switch {
+	case lv == nil && rv == nil:
+		return 0, nil, fmt.Errorf("comparisons between scalars are not supported")
+	case rv == nil:
+		return 0, filterVector(lv, func(v float64) bool { return compare(b.op, v, rs) }), nil
+	case lv == nil:
+		return 0, filterVector(rv, func(v float64) bool { return compare(b.op, ls, v) }), nil
+	}
+
+	rhs := make(map[model.Fingerprint]*model.Sample, len(rv))
+	for _, smpl := range rv {
+		sig := b.signature(smpl.Metric).Fingerprint()
+		if _, ok := rhs[sig]; ok {
+			return 0, nil, fmt.Errorf("found duplicate series for the match group %s on the right hand-side of the operation", b.signature(smpl.Metric))
+		}
+		rhs[sig] = smpl
+	}
+	out := model.Vector{}
+	for _, smpl := range lv {
+		r, ok := rhs[b.signature(smpl.Metric).Fingerprint()]
+		if ok && compare(b.op, float64(smpl.Value), float64(r.Value)) {
+			out = append(out, smpl)
+		}
+	}
+	return 0, out, nil
+}
+
+func filterVector(in model.Vector, keep func(float64) bool) model.Vector {
+	out := model.Vector{}
+	for _, smpl := range in {
+		if keep(float64(smpl.Value)) {
+			out = append(out, smpl)
+		}
+	}
+	return out
+}
+
+// signature 返回用于匹配的标签
+func (b *binaryExpr) signature(m model.Metric) model.Metric {
+	sig := model.Metric{}
+	for name, value := range m {
+		if name == model.MetricNameLabel || slices.Contains(b.matching, name) != b.on {
+			continue
+		}
+		sig[name] = value
+	}
+	return sig
+}
+
+func dropName(m model.Metric) model.Metric {
+	out := m.Clone()
+	delete(out, model.MetricNameLabel)
+	return out
+}
+
+// mapVector 与标量运算后结果不再是原来的指标，去掉指标名
+func mapVector(in model.Vector, fn func(float64) float64) model.Vector {
+	out := make(model.Vector, 0, len(in))
+	for _, smpl := range in {
+		out = append(out, &model.Sample{Metric: dropName(smpl.Metric), Value: model.SampleValue(fn(float64(smpl.Value)))})
+	}
+	return out
+}
+
+type aggregateExpr struct {
+	op      string
+	expr    Node
+	grouped bool
+	without bool
+	labels  []model.LabelName
+}
+
+func (a *aggregateExpr) eval(in model.Vector) (float64, model.Vector, error) {
+	_, v, err := a.expr.eval(in)
+	if err != nil {
+		return 0, nil, err
+	}
+	if v == nil {
+		return 0, nil, fmt.Errorf("%s() expects a vector", a.op)
+	}
+
+	type group struct {
+		metric model.Metric
+		value  float64
+		count  int
+	}
+	groups := make(map[model.Fingerprint]*group)
+	var order []model.Fingerprint
+	for _, smpl := range v {
+		metric := model.Metric{}
+		for name, value := range smpl.Metric {
+			if name == model.MetricNameLabel || slices.Contains(a.labels, name) == a.without {
+				continue
+			}
+			metric[name] = value
+		}
+		fp := metric.Fingerprint()
+		val := float64(smpl.Value)
+		g, ok := groups[fp]
+		if !ok {
+			groups[fp] = &group{metric: metric, value: val, count: 1}
+			order = append(order, fp)
+			continue
+		}
+		g.count++
+		switch a.op {
+		case "sum", "avg":
+			g.value += val
+		case "min":
+			g.value = math.Min(g.value, val)
+		case "max":
+			g.value = math.Max(g.value, val)
+		}
+	}
+
+	out := make(model.Vector, 0, len(groups))
+	for _, fp := range order {
+		g := groups[fp]
+		switch a.op {
+		case "avg":
+			g.value /= float64(g.count)
+		case "count":
+			g.value = float64(g.count)
+		}
+		out = append(out, &model.Sample{Metric: g.metric, Value: model.SampleValue(g.value)})
+	}
+	return 0, out, nil
+}
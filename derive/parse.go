@@ -0,0 +1,291 @@
+package derive
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"exporter-demo/labels"
+
+	"github.com/prometheus/common/model"
+)
+
+// aggregations 为支持的聚合函数
+var aggregations = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "count": true}
+
+type token struct {
+	kind string // ident、number、string 或运算符本身
+	text string
+	pos  int
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || c == ':' || c < unicode.MaxASCII && unicode.IsLetter(c):
+			start := i
+			for i < len(input) && (input[i] == '_' || input[i] == ':' || input[i] < unicode.MaxASCII && (unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i])))) {
+				i++
+			}
+			tokens = append(tokens, token{"ident", input[start:i], start})
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(input) && (unicode.IsDigit(rune(input[i])) || strings.ContainsRune(".eE", rune(input[i])) ||
+				(input[i] == '+' || input[i] == '-') && (input[i-1] == 'e' || input[i-1] == 'E')) {
+				i++
+			}
+			tokens = append(tokens, token{"number", input[start:i], start})
+		case c == '"' || c == '\'' || c == '`':
+			_, n, err := labels.ParseString(input[i:])
+			if err != nil {
+				return nil, fmt.Errorf("char %d: %w", i+1, err)
+			}
+			tokens = append(tokens, token{"string", input[i : i+n], i})
+			i += n
+		default:
+			op := ""
+			for _, o := range []string{"!=", "=~", "!~", "==", ">=", "<=", "=", ">", "<", "(", ")", "{", "}", ",", "+", "-", "*", "/"} {
+				if strings.HasPrefix(input[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("char %d: unexpected character %q", i+1, c)
+			}
+			tokens = append(tokens, token{op, op, i})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	input  string
+}
+
+// Parse parses an expression such as
+// sum by (user) (utmp_sessions) or load{time_linux="1m"} / ignoring(time_linux) cpus.
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, input: input}
+	n, err := p.expr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = p.errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{kind: "end", pos: len(p.input)}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(kind string) bool {
+	if p.peek().kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.errorfAt(t, "expected %s", kind)
+	}
+	return t, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return p.errorfAt(p.peek(), format, args...)
+}
+
+func (p *parser) errorfAt(t token, format string, args ...any) error {
+	return fmt.Errorf("char %d: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expr() (Node, error) {
+	return p.binary(comparisons, p.additive)
+}
+
+func (p *parser) additive() (Node, error) {
+	return p.binary([]string{"+", "-"}, p.term)
+}
+
+func (p *parser) term() (Node, error) {
+	return p.binary([]string{"*", "/"}, p.unary)
+}
+
+func (p *parser) binary(ops []string, operand func() (Node, error)) (Node, error) {
+	lhs, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().kind
+		if !slices.Contains(ops, op) {
+			return lhs, nil
+		}
+		p.next()
+		b := &binaryExpr{op: op, lhs: lhs}
+		if t := p.peek(); t.kind == "ident" && (t.text == "on" || t.text == "ignoring") {
+			p.next()
+			b.on = t.text == "on"
+			if b.matching, err = p.labelList(); err != nil {
+				return nil, err
+			}
+		}
+		if b.rhs, err = operand(); err != nil {
+			return nil, err
+		}
+		lhs = b
+	}
+}
+
+func (p *parser) unary() (Node, error) {
+	if p.accept("-") {
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryExpr{op: "*", lhs: numberLiteral(-1), rhs: n}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.peek()
+	switch t.kind {
+	case "number":
+		p.next()
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorfAt(t, "invalid number %q", t.text)
+		}
+		return numberLiteral(v), nil
+	case "(":
+		p.next()
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case "ident":
+		if aggregations[t.text] && p.pos+1 < len(p.tokens) {
+			if k := p.tokens[p.pos+1]; k.kind == "(" || k.kind == "ident" && (k.text == "by" || k.text == "without") {
+				return p.aggregate()
+			}
+		}
+		return p.selector(t)
+	case "{":
+		return p.selector(t)
+	}
+	return nil, p.errorf("unexpected %s", describe(t))
+}
+
+func describe(t token) string {
+	if t.kind == "end" {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+func (p *parser) aggregate() (Node, error) {
+	a := &aggregateExpr{op: p.next().text}
+	grouping := func() error {
+		t := p.peek()
+		if t.kind != "ident" || t.text != "by" && t.text != "without" {
+			return nil
+		}
+		if a.grouped {
+			return p.errorf("duplicate grouping")
+		}
+		p.next()
+		a.grouped, a.without = true, t.text == "without"
+		var err error
+		a.labels, err = p.labelList()
+		return err
+	}
+	if err := grouping(); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var err error
+	if a.expr, err = p.expr(); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if err := grouping(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (p *parser) labelList() ([]model.LabelName, error) {
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var names []model.LabelName
+	for !p.accept(")") {
+		t, err := p.expect("ident")
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, model.LabelName(t.text))
+		if !p.accept(",") && p.peek().kind != ")" {
+			return nil, p.errorf("expected , or )")
+		}
+	}
+	return names, nil
+}
+
+// selector 交给 labels.ParseSelector 解析从 t 开始的原始输入，再跳过其中的 token，
+// 使选择器语法与 history 的查询相同
+func (p *parser) selector(t token) (Node, error) {
+	matchers, n, err := labels.ParseSelector(p.input[t.pos:])
+	if err != nil {
+		pos := t.pos
+		var perr *labels.ParseError
+		if errors.As(err, &perr) {
+			pos += perr.Pos
+		}
+		return nil, fmt.Errorf("char %d: %w", pos+1, err)
+	}
+	for p.pos < len(p.tokens) && p.tokens[p.pos].pos < t.pos+n {
+		p.pos++
+	}
+	return &selector{matchers: matchers}, nil
+}
@@ -0,0 +1,125 @@
+package derive
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+// testSamples 中 cpu 每个 job 有两个 mode，cpus 每个 job 一个序列
+var testSamples = model.Vector{
+	{Metric: model.Metric{"__name__": "cpu", "job": "a", "mode": "user"}, Value: 1},
+	{Metric: model.Metric{"__name__": "cpu", "job": "a", "mode": "sys"}, Value: 2},
+	{Metric: model.Metric{"__name__": "cpu", "job": "b", "mode": "user"}, Value: 3},
+	{Metric: model.Metric{"__name__": "cpus", "job": "a"}, Value: 2},
+	{Metric: model.Metric{"__name__": "cpus", "job": "b"}, Value: 4},
+}
+
+// format 把结果排序后逐行输出，便于比较
+func format(v model.Vector) string {
+	lines := make([]string, 0, len(v))
+	for _, s := range v {
+		lines = append(lines, fmt.Sprintf("%s %v", s.Metric, s.Value))
+	}
+	slices.Sort(lines)
+	return strings.Join(lines, "\n")
+}
+
+func TestEval(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		want []string
+		err  string
+	}{
+		// 优先级：乘除高于加减，加减高于比较
+		{expr: `1 + 2 * 3`, want: []string{`{} 7`}},
+		{expr: `(1 + 2) * 3`, want: []string{`{} 9`}},
+		{expr: `2 * 3 - 4 / 2`, want: []string{`{} 4`}},
+		{expr: `8 / 2 / 2`, want: []string{`{} 2`}},
+		{expr: `cpu + 1 > 2`, want: []string{`{job="a", mode="sys"} 3`, `{job="b", mode="user"} 4`}},
+		{expr: `cpu > 1`, want: []string{`cpu{job="a", mode="sys"} 2`, `cpu{job="b", mode="user"} 3`}},
+		{expr: `2 <= cpu`, want: []string{`cpu{job="a", mode="sys"} 2`, `cpu{job="b", mode="user"} 3`}},
+		{expr: `1 < 2`, err: "comparisons between scalars are not supported"},
+
+		// 一元负号
+		{expr: `-2 * 3`, want: []string{`{} -6`}},
+		{expr: `1 - -1`, want: []string{`{} 2`}},
+		{expr: `-(1 + 2)`, want: []string{`{} -3`}},
+		{expr: `-cpus`, want: []string{`{job="a"} -2`, `{job="b"} -4`}},
+
+		// 向量匹配
+		{expr: `cpu{mode="user"} / ignoring(mode) cpus`, want: []string{`{job="a"} 0.5`, `{job="b"} 0.75`}},
+		{expr: "cpu { mode = 'user', } / on(job) cpus", want: []string{`{job="a"} 0.5`, `{job="b"} 0.75`}},
+		{expr: `cpu{mode="user"} / on(job) cpus`, want: []string{`{job="a"} 0.5`, `{job="b"} 0.75`}},
+		{expr: `cpu{mode="user"} > on(job) cpus`, want: nil},
+		{expr: `cpus >= ignoring(mode) cpu{mode="user"}`, want: []string{`cpus{job="a"} 2`, `cpus{job="b"} 4`}},
+		{expr: `cpu / cpus`, want: nil},
+		{expr: `cpu / on(job) cpus`, err: `found duplicate series for the match group {job="a"} on the left hand-side`},
+		{expr: `cpu / ignoring(mode) cpus`, err: "on the left hand-side"},
+		{expr: `cpus / on() cpu`, err: "found duplicate series for the match group {} on the right hand-side"},
+		{expr: `cpus > on() cpu`, err: "on the right hand-side"},
+
+		// 聚合，by/without 可以写在参数前后
+		{expr: `sum by (job) (cpu)`, want: []string{`{job="a"} 3`, `{job="b"} 3`}},
+		{expr: `sum(cpu) by (job)`, want: []string{`{job="a"} 3`, `{job="b"} 3`}},
+		{expr: `sum without (mode) (cpu)`, want: []string{`{job="a"} 3`, `{job="b"} 3`}},
+		{expr: `sum(cpu) without (mode)`, want: []string{`{job="a"} 3`, `{job="b"} 3`}},
+		{expr: `avg by (mode) (cpu)`, want: []string{`{mode="sys"} 2`, `{mode="user"} 2`}},
+		{expr: `max without (job, mode) (cpu)`, want: []string{`{} 3`}},
+		{expr: `min(cpu)`, want: []string{`{} 1`}},
+		{expr: `count({__name__=~"cpus?"})`, want: []string{`{} 5`}},
+		{expr: `sum by (job) (cpu) / on(job) cpus`, want: []string{`{job="a"} 1.5`, `{job="b"} 0.75`}},
+		{expr: `sum(1)`, err: "sum() expects a vector"},
+		{expr: `sum by (job) (cpu) by (mode)`, err: "char 20: duplicate grouping"},
+	} {
+		expr, err := ParseExpr(tc.expr)
+		var got model.Vector
+		if err == nil {
+			got, err = expr.Eval(testSamples)
+		}
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: error = %v, want %q", tc.expr, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if want := strings.Join(tc.want, "\n"); format(got) != want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", tc.expr, format(got), want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr, err string
+	}{
+		{`cpu +`, "char 6: unexpected end of expression"},
+		{`cpu + * 2`, `char 7: unexpected "*"`},
+		{`cpu{job=a}`, "char 9: expected a quoted string"},
+		{`cpu{a:b="x"}`, "char 5: expected a label name"},
+		{`{job=~".*"}`, "char 12: selector must contain at least one matcher that does not match the empty string"},
+		{`cpu{job~"a"}`, "char 8: unexpected character '~'"},
+		{`cpu{job="a" mode="b"}`, "char 13: expected , or }"},
+		{`cpu{job=~"("}`, `char 10: invalid regex "("`},
+		{`cpu{job="a}`, "char 9: unterminated string"},
+		{`sum by (job x) (cpu)`, "char 13: expected , or )"},
+		{`sum by job (cpu)`, "char 8: expected ("},
+		{`(cpu`, "char 5: expected )"},
+		{`cpu cpus`, `char 5: unexpected "cpus"`},
+		{`cpu / on(job cpus`, "char 14: expected , or )"},
+		{`1e`, `char 1: invalid number "1e"`},
+		{``, "char 1: unexpected end of expression"},
+	} {
+		_, err := Parse(tc.expr)
+		if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+			t.Errorf("Parse(%q) error = %v, want %q", tc.expr, err, tc.err)
+		}
+	}
+}
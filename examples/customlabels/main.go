@@ -18,20 +18,20 @@ func main() {
 	flag.Parse()
 
 	requestDurations := prometheus.NewHistogram(prometheus.HistogramOpts{
-		Name:        "http_request_duration_seconds",
-		Help:        "A histogram of the HTTP request durations in seconds.",
-		Namespace:   "stathe",
-		Buckets:     prometheus.ExponentialBuckets(0.1, 1.5, 5),
-		ConstLabels: prometheus.Labels{"serviceName": "my-service-name"},
+		Name:    "http_request_duration_seconds",
+		Help:    "A histogram of the HTTP request durations in seconds.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 1.5, 5),
 	})
 
 	//create a new registroy.
 	reg := prometheus.NewRegistry()
-	prometheus.WrapRegistererWith(prometheus.Labels{"serviceName": "my-service-name"}, reg).MustRegister(
+	//标签和 namespace 只在这里配置一次，作用于所有注册的采集器
+	labeled := prometheus.WrapRegistererWith(prometheus.Labels{"serviceName": "my-service-name"}, reg)
+	labeled.MustRegister(
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 		collectors.NewGoCollector(),
 	)
-	reg.MustRegister(requestDurations)
+	prometheus.WrapRegistererWithPrefix("stathe_", labeled).MustRegister(requestDurations)
 
 	go func() {
 		for {
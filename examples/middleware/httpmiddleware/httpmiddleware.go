@@ -1,7 +1,10 @@
 package httpmiddleware
 
 import (
+	"context"
+	"exporter-demo/expire"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -15,6 +18,10 @@ type Middleware interface {
 type middleware struct {
 	buckets  []float64
 	registry prometheus.Registerer
+
+	// ttl 大于 0 时，超过 ttl 没有请求的 method、code 组合会被删除
+	ctx context.Context
+	ttl time.Duration
 }
 
 func (m *middleware) WarpHandler(handlerName string, handler http.Handler) http.HandlerFunc {
@@ -22,42 +29,47 @@ func (m *middleware) WarpHandler(handlerName string, handler http.Handler) http.
 
 	requestTotal := promauto.With(reg).NewCounterVec(
 		prometheus.CounterOpts{
-			Name:      "http_requests_total",
-			Namespace: "stathe",
-			Help:      "Tracks the number of HTTP requests.",
+			Name: "http_requests_total",
+			Help: "Tracks the number of HTTP requests.",
 		}, []string{"method", "code"},
 	)
 
 	requestDuration := promauto.With(reg).NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:      "http_request_duration_seconds",
-			Help:      "Tracks the latencies for HTTP requests.",
-			Namespace: "stathe",
-			Buckets:   m.buckets,
+			Name:    "http_request_duration_seconds",
+			Help:    "Tracks the latencies for HTTP requests.",
+			Buckets: m.buckets,
 		},
 		[]string{"method", "code"},
 	)
 
 	requestSize := promauto.With(reg).NewSummaryVec(
 		prometheus.SummaryOpts{
-			Name:      "http_request_szie_bytes",
-			Namespace: "stathe",
-			Help:      "Tracks the size of HTTP requests.",
+			Name: "http_request_szie_bytes",
+			Help: "Tracks the size of HTTP requests.",
 		}, []string{"method", "code"},
 	)
 
 	responseSize := promauto.With(reg).NewSummaryVec(
 		prometheus.SummaryOpts{
-			Name:      "http_response_size_bytes",
-			Namespace: "stathe",
-			Help:      "Tracks the size of HTTP responses.",
+			Name: "http_response_size_bytes",
+			Help: "Tracks the size of HTTP responses.",
 		}, []string{"method", "code"},
 	)
 
+	var durationVec prometheus.ObserverVec = requestDuration
+	if m.ttl > 0 {
+		// 每个请求都会以相同的 method、code 更新四个指标，由耗时直方图记录更新时间，过期时一并删除
+		expiring := expire.NewObserverVec(requestDuration, []string{"method", "code"}, m.ttl)
+		expiring.Link(requestTotal, requestSize, responseSize)
+		durationVec = expire.ObserverVec(expiring)
+		go expiring.Run(m.ctx)
+	}
+
 	base := promhttp.InstrumentHandlerCounter(
 		requestTotal,
 		promhttp.InstrumentHandlerDuration(
-			requestDuration,
+			durationVec,
 			promhttp.InstrumentHandlerRequestSize(
 				requestSize,
 				promhttp.InstrumentHandlerResponseSize(
@@ -71,13 +83,22 @@ func (m *middleware) WarpHandler(handlerName string, handler http.Handler) http.
 
 }
 
+// New 创建的指标不带 namespace，需要前缀时传入 prometheus.WrapRegistererWithPrefix 包装后的 registry
 func New(registry prometheus.Registerer, buckets []float64) Middleware {
+	return NewWithTTL(context.Background(), registry, buckets, 0)
+}
+
+// NewWithTTL is like New, but series that saw no request for ttl are deleted
+// until ctx is done. A ttl of 0 keeps all series.
+func NewWithTTL(ctx context.Context, registry prometheus.Registerer, buckets []float64, ttl time.Duration) Middleware {
 	if buckets == nil {
 		buckets = prometheus.ExponentialBuckets(0.1, 1.5, 5)
 	}
 	return &middleware{
 		buckets:  buckets,
 		registry: registry,
+		ctx:      ctx,
+		ttl:      ttl,
 	}
 }
 
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"exporter-demo/examples/middleware/httpmiddleware"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
@@ -24,6 +26,6 @@ func main() {
 
 	http.Handle(
 		"/metrics",
-		httpmiddleware.New(registry, nil).WarpHandler("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+		httpmiddleware.NewWithTTL(context.Background(), prometheus.WrapRegistererWithPrefix("stathe_", registry), nil, 10*time.Minute).WarpHandler("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
 	log.Fatalln(http.ListenAndServe(":8080", nil))
 }
@@ -4,7 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
-	"log"
+	"log/slog"
+	"os"
 )
 
 func main() {
@@ -15,6 +16,7 @@ func main() {
 	})
 	err := r.Run(":8080")
 	if err != nil {
-		log.Fatalln(err)
+		slog.Error("server stopped", "err", err)
+		os.Exit(1)
 	}
 }
@@ -2,12 +2,16 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"exporter-demo/expire"
+	"exporter-demo/limit"
+
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/push"
@@ -20,6 +24,10 @@ const (
 	PrometheusNameSpace2      = "stathe"
 	EndpointsDataSubSystem2   = "endpoints"
 	ErrorCodeDataSubsystem    = "code"
+	// MaxErrorcodeSeries 限制 endpoints 与 code 组合的个数，多出的计入 __overflow__
+	MaxErrorcodeSeries = 200
+	// ErrorcodeTTL 内没有请求的序列会被删除，接口下线或错误信息变化后旧序列不再上报
+	ErrorcodeTTL = 10 * time.Minute
 )
 
 /*
@@ -29,14 +37,14 @@ Gauge可增减的仪表盘
 */
 var (
 	pusher2                   *push.Pusher
-	endpointsErrorcodeMonitor = prometheus.NewGaugeVec(
+	endpointsErrorcodeMonitor = expire.NewGaugeVec(limit.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: PrometheusNameSpace2,
 			Subsystem: EndpointsDataSubSystem2,
 			Name:      "errcode_statistic",
 			Help:      "统计接口错误码信息数据",
-		}, []string{EndpointsDataSubSystem2, ErrorCodeDataSubsystem},
-	)
+		}, []string{EndpointsDataSubSystem2, ErrorCodeDataSubsystem}, MaxErrorcodeSeries,
+	), []string{EndpointsDataSubSystem2, ErrorCodeDataSubsystem}, ErrorcodeTTL)
 )
 
 type RespCode struct {
@@ -105,9 +113,9 @@ func HandleEndpointErrorcode() gin.HandlerFunc {
 		defer func(c *gin.Context) {
 			var resp DataResp
 
-			fmt.Println(model.respBody.String())
+			slog.Debug("endpoint response", "endpoint", endpoint, "body", model.respBody.String())
 			if err := json.Unmarshal(model.respBody.Bytes(), &resp); err != nil {
-				log.Printf("json unmarsh respBody failed %+v", resp)
+				slog.Warn("json unmarsh respBody failed", "endpoint", endpoint, "err", err)
 				//panic(err)
 			}
 			endpointsErrorcodeMonitor.With(prometheus.Labels{EndpointsDataSubSystem2: endpoint, ErrorCodeDataSubsystem: resp.Msg}).Inc()
@@ -119,13 +127,17 @@ func HandleEndpointErrorcode() gin.HandlerFunc {
 func main() {
 	r := gin.New()
 
+	go endpointsErrorcodeMonitor.Run(context.Background())
+
 	//15 second push metrics
 	go func() {
 		for range time.Tick(15 * time.Second) {
-			if err := pusher2.Add(); err != nil {
-				log.Println(err)
+			// Push 替换整个分组，过期删除的序列也会从 Pushgateway 上消失
+			if err := pusher2.Push(); err != nil {
+				slog.Error("push to Pushgateway failed", "err", err)
+				continue
 			}
-			log.Println("interface time push ")
+			slog.Debug("interface time push")
 		}
 
 	}()
@@ -137,12 +149,12 @@ func main() {
 		req := func(endpoint string) {
 			defer func() {
 				if r := recover(); r != nil {
-					log.Println(r)
+					slog.Error("request failed", "endpoint", endpoint, "panic", r)
 				}
 			}()
 
 			_, err := http.Get(fmt.Sprintf("http://localhost%s%s", Port2, endpoint))
-			fmt.Printf("http://localhost%s%s\n", Port2, endpoint)
+			slog.Debug("request sent", "url", fmt.Sprintf("http://localhost%s%s", Port2, endpoint))
 			if err != nil {
 				panic(err)
 			}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"exporter-demo/expire"
+	"exporter-demo/limit"
+
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/push"
@@ -17,6 +21,10 @@ const (
 	PrometheusJob            = "gin_test_prometheus_qps"
 	PrometheusNameSpace      = "stathe"
 	EndpointsDataSubSystem   = "endpoints"
+	// MaxEndpoints 限制 endpoints 标签的取值个数，扫描随机 URL 时多出的请求计入 __overflow__
+	MaxEndpoints = 100
+	// EndpointTTL 内没有请求的序列会被删除，接口下线或错误信息变化后旧序列不再上报
+	EndpointTTL = 10 * time.Minute
 )
 
 /*
@@ -26,14 +34,14 @@ PrometheusNameSpace +  EndpointsDataSubSystem  + Name
 */
 var (
 	pusher              *push.Pusher
-	endpointsQPSMonitor = prometheus.NewCounterVec(
+	endpointsQPSMonitor = expire.NewCounterVec(limit.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: PrometheusNameSpace,
 			Subsystem: EndpointsDataSubSystem,
 			Name:      "QPS_statistic",
 			Help:      "统计QPS数据",
-		}, []string{EndpointsDataSubSystem},
-	)
+		}, []string{EndpointsDataSubSystem}, MaxEndpoints,
+	), []string{EndpointsDataSubSystem}, EndpointTTL)
 )
 
 func init() {
@@ -48,7 +56,7 @@ func init() {
 func HandleEndpointQps() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		endpoint := c.Request.URL.Path
-		fmt.Println("endpoint", endpoint)
+		slog.Debug("endpoint request", "endpoint", endpoint)
 		endpointsQPSMonitor.With(prometheus.Labels{EndpointsDataSubSystem: endpoint}).Inc()
 		c.Next()
 	}
@@ -58,14 +66,18 @@ func main() {
 
 	r := gin.New()
 
+	go endpointsQPSMonitor.Run(context.Background())
+
 	//每十五秒上报一次数据
 	go func() {
 		// 通过for编写一个死循环，每15s执行一次
 		for range time.Tick(15 * time.Second) {
-			if err := pusher.Add(); err != nil {
-				log.Println(err)
+			// Push 替换整个分组，过期删除的序列也会从 Pushgateway 上消失
+			if err := pusher.Push(); err != nil {
+				slog.Error("push to Pushgateway failed", "err", err)
+				continue
 			}
-			log.Println("push PushGatewayServer endpoints count message is OK")
+			slog.Debug("push PushGatewayServer endpoints count message is OK")
 		}
 	}()
 
@@ -75,7 +87,7 @@ func main() {
 			defer func() {
 				//管理panic异常并处理，没有panic,r返回nil；反之打印panic信息，并阻止panic进一步向外传播
 				if r := recover(); r != nil {
-					log.Println("panic message", r)
+					slog.Error("request failed", "endpoint", endpoint, "panic", r)
 				}
 			}()
 
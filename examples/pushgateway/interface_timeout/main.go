@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"strconv"
 	"time"
 
+	"exporter-demo/expire"
+	"exporter-demo/limit"
+
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/push"
@@ -19,6 +23,10 @@ const (
 	PrometheusJob1            = "gin_test_prometheus_interface_timeout"
 	PrometheusNameSpace1      = "stathe"
 	EndpointsDataSubSystem1   = "endpoints"
+	// MaxEndpoints1 限制 endpoints 标签的取值个数，多出的请求计入 __overflow__
+	MaxEndpoints1 = 100
+	// EndpointTTL1 内没有请求的序列会被删除，接口下线或错误信息变化后旧序列不再上报
+	EndpointTTL1 = 10 * time.Minute
 )
 
 /*
@@ -26,15 +34,15 @@ Histogram 直方图 数据分布情况
 */
 var (
 	pusher1                 *push.Pusher
-	endpointLantencyMonitor = prometheus.NewHistogramVec(
+	endpointLantencyMonitor = expire.NewObserverVec(limit.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: PrometheusNameSpace1,
 			Subsystem: EndpointsDataSubSystem1,
 			Name:      "lantency_statistic",
 			Help:      "统计接口耗时数据",
 			Buckets:   []float64{1, 5, 10, 20, 50, 100, 500, 1000, 5000, 10000},
-		}, []string{EndpointsDataSubSystem1},
-	)
+		}, []string{EndpointsDataSubSystem1}, MaxEndpoints1,
+	), []string{EndpointsDataSubSystem1}, EndpointTTL1)
 )
 
 func init() {
@@ -48,7 +56,7 @@ func init() {
 func HandleEndpointLantency() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		endpoint := c.Request.URL.Path
-		fmt.Println("endpoint", endpoint)
+		slog.Debug("endpoint request", "endpoint", endpoint)
 		start := time.Now()
 		defer func(c *gin.Context) {
 			lantency := time.Now().Sub(start)
@@ -57,7 +65,7 @@ func HandleEndpointLantency() gin.HandlerFunc {
 			if err != nil {
 				panic(err)
 			}
-			fmt.Println("lantencyFloat64", lantencyFloat64)
+			slog.Debug("endpoint latency", "endpoint", endpoint, "lantencyFloat64", lantencyFloat64)
 			endpointLantencyMonitor.With(prometheus.Labels{EndpointsDataSubSystem1: endpoint}).Observe(lantencyFloat64)
 		}(c)
 		c.Next()
@@ -67,12 +75,15 @@ func HandleEndpointLantency() gin.HandlerFunc {
 
 func main() {
 	r := gin.New()
+	go endpointLantencyMonitor.Run(context.Background())
 	go func() {
 		for range time.Tick(15 * time.Second) {
-			if err := pusher1.Add(); err != nil {
-				log.Println(err)
+			// Push 替换整个分组，过期删除的序列也会从 Pushgateway 上消失
+			if err := pusher1.Push(); err != nil {
+				slog.Error("push to Pushgateway failed", "err", err)
+				continue
 			}
-			log.Println("push")
+			slog.Debug("push")
 		}
 
 	}()
@@ -82,7 +93,7 @@ func main() {
 		req := func(endpoint string) {
 			defer func() {
 				if r := recover(); r != nil {
-					log.Println(r)
+					slog.Error("request failed", "endpoint", endpoint, "panic", r)
 				}
 
 			}()
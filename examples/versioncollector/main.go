@@ -17,6 +17,7 @@ func main() {
 	flag.Parse()
 	reg := prometheus.NewRegistry()
 	//导出有关当前版本信息的度量。
+	//版本数据需在构建时通过 -ldflags 注入 github.com/prometheus/common/version，参考根目录 Makefile
 	reg.MustRegister(version.NewCollector("example"))
 
 	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{
@@ -0,0 +1,360 @@
+// Package expire deletes series of metric vectors that stopped being updated.
+package expire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Deleter 为 CounterVec、GaugeVec、HistogramVec、SummaryVec 以及 limit.Vec 的公共部分
+type Deleter interface {
+	prometheus.Collector
+	Delete(labels prometheus.Labels) bool
+}
+
+// labelVec 为可以包装的向量，T 为 Counter、Gauge 或 Observer
+type labelVec[T any] interface {
+	Deleter
+	WithLabelValues(lvs ...string) T
+	With(labels prometheus.Labels) T
+}
+
+// Vec 包装一个指标向量，记录每个标签组合最近一次通过 Vec 更新的时间，
+// Run 期间删除超过 ttl 未更新的序列。直接在原向量上创建或更新的序列不会被跟踪。
+type Vec[T any] struct {
+	vec        labelVec[T]
+	wrap       func(m T, touch func()) T
+	labelNames []string
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	touched map[string]time.Time
+	linked  []Deleter
+}
+
+// NewCounterVec wraps a *prometheus.CounterVec or a limit counter vector
+// whose variable labels are labelNames.
+func NewCounterVec(vec labelVec[prometheus.Counter], labelNames []string, ttl time.Duration) *Vec[prometheus.Counter] {
+	return newVec(vec, labelNames, ttl, func(c prometheus.Counter, touch func()) prometheus.Counter {
+		return &counter{c, touch}
+	})
+}
+
+// NewGaugeVec wraps a *prometheus.GaugeVec or a limit gauge vector.
+func NewGaugeVec(vec labelVec[prometheus.Gauge], labelNames []string, ttl time.Duration) *Vec[prometheus.Gauge] {
+	return newVec(vec, labelNames, ttl, func(g prometheus.Gauge, touch func()) prometheus.Gauge {
+		return &gauge{g, touch}
+	})
+}
+
+// NewObserverVec wraps a *prometheus.HistogramVec, *prometheus.SummaryVec or
+// a limit histogram vector.
+func NewObserverVec(vec labelVec[prometheus.Observer], labelNames []string, ttl time.Duration) *Vec[prometheus.Observer] {
+	return newVec(vec, labelNames, ttl, func(o prometheus.Observer, touch func()) prometheus.Observer {
+		return &observer{o, touch}
+	})
+}
+
+func newVec[T any](vec labelVec[T], labelNames []string, ttl time.Duration, wrap func(T, func()) T) *Vec[T] {
+	return &Vec[T]{
+		vec:        vec,
+		wrap:       wrap,
+		labelNames: labelNames,
+		ttl:        ttl,
+		now:        time.Now,
+		touched:    make(map[string]time.Time),
+	}
+}
+
+// Link makes expired label sets also be deleted from vecs. It suits vectors
+// that are always updated together with v under the same labels but cannot
+// be wrapped, such as the counter passed to promhttp.InstrumentHandlerCounter.
+func (v *Vec[T]) Link(vecs ...Deleter) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.linked = append(v.linked, vecs...)
+}
+
+// WithLabelValues returns the series for lvs. Creating it and every later
+// update through the returned metric count as a touch.
+func (v *Vec[T]) WithLabelValues(lvs ...string) T {
+	// 先记录再取序列：sweep 在两者之间删除时，下面会重新创建序列
+	key := strings.Join(lvs, "\xff")
+	v.touch(key)
+	m := v.vec.WithLabelValues(lvs...)
+	return v.wrap(m, func() { v.touch(key) })
+}
+
+// With is like WithLabelValues with the values given by name.
+func (v *Vec[T]) With(labels prometheus.Labels) T {
+	lvs := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		lvs[i] = labels[name]
+	}
+	key := strings.Join(lvs, "\xff")
+	v.touch(key)
+	m := v.vec.With(labels)
+	return v.wrap(m, func() { v.touch(key) })
+}
+
+// Delete removes the series with the given labels and stops tracking it.
+func (v *Vec[T]) Delete(labels prometheus.Labels) bool {
+	lvs := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		lvs[i] = labels[name]
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.touched, strings.Join(lvs, "\xff"))
+	return v.vec.Delete(labels)
+}
+
+func (v *Vec[T]) touch(key string) {
+	now := v.now()
+	v.mu.Lock()
+	v.touched[key] = now
+	v.mu.Unlock()
+}
+
+func (v *Vec[T]) Describe(ch chan<- *prometheus.Desc) {
+	v.vec.Describe(ch)
+}
+
+func (v *Vec[T]) Collect(ch chan<- prometheus.Metric) {
+	v.vec.Collect(ch)
+}
+
+// Run sweeps the vector every ttl/2 until ctx is done.
+func (v *Vec[T]) Run(ctx context.Context) error {
+	if v.ttl <= 0 {
+		return errors.New("expire: ttl must be positive")
+	}
+	ticker := time.NewTicker(v.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			v.sweep(v.now())
+		}
+	}
+}
+
+// sweep 删除超过 ttl 未更新的序列。判断和删除在同一次加锁内完成，
+// 期间被更新的序列不会被误删；linked 在释放锁后删除，避免互相 Link 的 Vec 死锁
+func (v *Vec[T]) sweep(now time.Time) {
+	v.mu.Lock()
+	var stale []prometheus.Labels
+	for key, touched := range v.touched {
+		if now.Sub(touched) < v.ttl {
+			continue
+		}
+		delete(v.touched, key)
+		labels := make(prometheus.Labels, len(v.labelNames))
+		for i, lv := range strings.Split(key, "\xff") {
+			labels[v.labelNames[i]] = lv
+		}
+		v.vec.Delete(labels)
+		stale = append(stale, labels)
+	}
+	linked := v.linked
+	v.mu.Unlock()
+
+	for _, labels := range stale {
+		for _, d := range linked {
+			d.Delete(labels)
+		}
+	}
+}
+
+// ObserverVec adapts v to prometheus.ObserverVec so that it can be passed to
+// the promhttp instrumentation helpers. The wrapped vector must be a
+// *prometheus.HistogramVec or *prometheus.SummaryVec.
+func ObserverVec(v *Vec[prometheus.Observer]) prometheus.ObserverVec {
+	inner, ok := v.vec.(prometheus.ObserverVec)
+	if !ok {
+		panic(fmt.Sprintf("expire: %T is not a prometheus.ObserverVec", v.vec))
+	}
+	return &observerVec{v: v, inner: inner}
+}
+
+// observerVec 支持柯里化，curried 为已固定的标签，与调用时的标签合起来确定序列
+type observerVec struct {
+	v       *Vec[prometheus.Observer]
+	inner   prometheus.ObserverVec
+	curried prometheus.Labels
+}
+
+func (o *observerVec) GetMetricWith(labels prometheus.Labels) (prometheus.Observer, error) {
+	m, err := o.inner.GetMetricWith(labels)
+	if err != nil {
+		return nil, err
+	}
+	all := make(prometheus.Labels, len(o.curried)+len(labels))
+	for k, lv := range o.curried {
+		all[k] = lv
+	}
+	for k, lv := range labels {
+		all[k] = lv
+	}
+	lvs := make([]string, len(o.v.labelNames))
+	for i, name := range o.v.labelNames {
+		lvs[i] = all[name]
+	}
+	key := strings.Join(lvs, "\xff")
+	o.v.touch(key)
+	return o.v.wrap(m, func() { o.v.touch(key) }), nil
+}
+
+func (o *observerVec) GetMetricWithLabelValues(lvs ...string) (prometheus.Observer, error) {
+	// 按未柯里化的标签顺序还原标签名
+	var names []string
+	for _, name := range o.v.labelNames {
+		if _, ok := o.curried[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	if len(lvs) != len(names) {
+		return nil, fmt.Errorf("expire: got %d label values, want %d", len(lvs), len(names))
+	}
+	labels := make(prometheus.Labels, len(lvs))
+	for i, lv := range lvs {
+		labels[names[i]] = lv
+	}
+	return o.GetMetricWith(labels)
+}
+
+func (o *observerVec) With(labels prometheus.Labels) prometheus.Observer {
+	m, err := o.GetMetricWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (o *observerVec) WithLabelValues(lvs ...string) prometheus.Observer {
+	m, err := o.GetMetricWithLabelValues(lvs...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (o *observerVec) CurryWith(labels prometheus.Labels) (prometheus.ObserverVec, error) {
+	inner, err := o.inner.CurryWith(labels)
+	if err != nil {
+		return nil, err
+	}
+	curried := make(prometheus.Labels, len(o.curried)+len(labels))
+	for k, lv := range o.curried {
+		curried[k] = lv
+	}
+	for k, lv := range labels {
+		curried[k] = lv
+	}
+	return &observerVec{v: o.v, inner: inner, curried: curried}, nil
+}
+
+func (o *observerVec) MustCurryWith(labels prometheus.Labels) prometheus.ObserverVec {
+	vec, err := o.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
+func (o *observerVec) Describe(ch chan<- *prometheus.Desc) {
+	o.inner.Describe(ch)
+}
+
+func (o *observerVec) Collect(ch chan<- prometheus.Metric) {
+	o.inner.Collect(ch)
+}
+
+// 以下包装在每次更新时记录时间，exemplar 方法在原指标不支持时退化为普通更新
+
+type counter struct {
+	prometheus.Counter
+	touch func()
+}
+
+func (c *counter) Inc() {
+	c.Counter.Inc()
+	c.touch()
+}
+
+func (c *counter) Add(v float64) {
+	c.Counter.Add(v)
+	c.touch()
+}
+
+func (c *counter) AddWithExemplar(v float64, e prometheus.Labels) {
+	if ea, ok := c.Counter.(prometheus.ExemplarAdder); ok {
+		ea.AddWithExemplar(v, e)
+	} else {
+		c.Counter.Add(v)
+	}
+	c.touch()
+}
+
+type gauge struct {
+	prometheus.Gauge
+	touch func()
+}
+
+func (g *gauge) Set(v float64) {
+	g.Gauge.Set(v)
+	g.touch()
+}
+
+func (g *gauge) Inc() {
+	g.Gauge.Inc()
+	g.touch()
+}
+
+func (g *gauge) Dec() {
+	g.Gauge.Dec()
+	g.touch()
+}
+
+func (g *gauge) Add(v float64) {
+	g.Gauge.Add(v)
+	g.touch()
+}
+
+func (g *gauge) Sub(v float64) {
+	g.Gauge.Sub(v)
+	g.touch()
+}
+
+func (g *gauge) SetToCurrentTime() {
+	g.Gauge.SetToCurrentTime()
+	g.touch()
+}
+
+type observer struct {
+	prometheus.Observer
+	touch func()
+}
+
+func (o *observer) Observe(v float64) {
+	o.Observer.Observe(v)
+	o.touch()
+}
+
+func (o *observer) ObserveWithExemplar(v float64, e prometheus.Labels) {
+	if eo, ok := o.Observer.(prometheus.ExemplarObserver); ok {
+		eo.ObserveWithExemplar(v, e)
+	} else {
+		o.Observer.Observe(v)
+	}
+	o.touch()
+}
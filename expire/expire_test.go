@@ -0,0 +1,141 @@
+package expire
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestGaugeSetToSameValueIsNotStale(t *testing.T) {
+	clock := &fakeClock{time.Unix(1000, 0)}
+	v := NewGaugeVec(prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "g", Help: "h"}, []string{"k"}), []string{"k"}, time.Minute)
+	v.now = clock.now
+
+	busy := v.WithLabelValues("busy")
+	busy.Set(1)
+	v.With(prometheus.Labels{"k": "idle"}).Set(1)
+
+	// busy 一直被设置为相同的值，idle 之后没有更新
+	for range 4 {
+		clock.advance(30 * time.Second)
+		busy.Set(1)
+		v.sweep(clock.now())
+	}
+	if got := testutil.CollectAndCount(v); got != 1 {
+		t.Fatalf("got %d series, want only busy", got)
+	}
+	if got := testutil.ToFloat64(busy); got != 1 {
+		t.Errorf("busy = %v, want 1", got)
+	}
+
+	clock.advance(time.Minute)
+	v.sweep(clock.now())
+	if got := testutil.CollectAndCount(v); got != 0 {
+		t.Errorf("got %d series after ttl without updates, want 0", got)
+	}
+}
+
+func TestCounterAndObserverTouch(t *testing.T) {
+	clock := &fakeClock{time.Unix(1000, 0)}
+	c := NewCounterVec(prometheus.NewCounterVec(prometheus.CounterOpts{Name: "c", Help: "h"}, []string{"k"}), []string{"k"}, time.Minute)
+	o := NewObserverVec(prometheus.NewSummaryVec(prometheus.SummaryOpts{Name: "s", Help: "h"}, []string{"k"}), []string{"k"}, time.Minute)
+	c.now, o.now = clock.now, clock.now
+
+	counter, obs := c.WithLabelValues("a"), o.WithLabelValues("a")
+	clock.advance(50 * time.Second)
+	counter.Add(2)
+	obs.Observe(1)
+	clock.advance(50 * time.Second)
+	c.sweep(clock.now())
+	o.sweep(clock.now())
+	if testutil.CollectAndCount(c) != 1 || testutil.CollectAndCount(o) != 1 {
+		t.Fatal("series updated within ttl were deleted")
+	}
+
+	// Delete 后不再跟踪该序列
+	c.Delete(prometheus.Labels{"k": "a"})
+	if len(c.touched) != 0 {
+		t.Errorf("deleted series still tracked: %v", c.touched)
+	}
+}
+
+func TestObserverVecWithPromhttpAndLinked(t *testing.T) {
+	clock := &fakeClock{time.Unix(1000, 0)}
+	total := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "h"}, []string{"method", "code"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration_seconds", Help: "h"}, []string{"method", "code"})
+	v := NewObserverVec(duration, []string{"method", "code"}, time.Minute)
+	v.now = clock.now
+	v.Link(total)
+
+	h := promhttp.InstrumentHandlerCounter(total,
+		promhttp.InstrumentHandlerDuration(ObserverVec(v), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := testutil.ToFloat64(total.WithLabelValues("get", "418")); got != 1 {
+		t.Fatalf("requests_total = %v, want 1", got)
+	}
+	if _, ok := v.touched["get\xff418"]; !ok {
+		t.Fatalf("request did not touch the label set, tracked: %v", v.touched)
+	}
+
+	clock.advance(time.Minute)
+	v.sweep(clock.now())
+	if testutil.CollectAndCount(duration) != 0 || testutil.CollectAndCount(total) != 0 {
+		t.Error("expired label set not deleted from both vectors")
+	}
+}
+
+// racyGaugeVec 在删除序列前调用 beforeDelete，模拟 sweep 删除期间另一个 goroutine 的更新
+type racyGaugeVec struct {
+	*prometheus.GaugeVec
+	beforeDelete func()
+}
+
+func (v *racyGaugeVec) Delete(labels prometheus.Labels) bool {
+	v.beforeDelete()
+	return v.GaugeVec.Delete(labels)
+}
+
+// sweep 期间被更新的序列不能被删除
+func TestSweepConcurrentTouch(t *testing.T) {
+	clock := &fakeClock{time.Unix(1000, 0)}
+	inner := &racyGaugeVec{GaugeVec: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "g", Help: "h"}, []string{"k"})}
+	v := NewGaugeVec(inner, []string{"k"}, time.Minute)
+	v.now = clock.now
+	v.WithLabelValues("a").Set(1)
+	clock.advance(2 * time.Minute)
+
+	updated := make(chan struct{})
+	inner.beforeDelete = func() {
+		go func() {
+			defer close(updated)
+			v.WithLabelValues("a").Set(2)
+		}()
+		// 给更新一点时间，它要么在删除前完成，要么等到 sweep 结束
+		select {
+		case <-updated:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	v.sweep(clock.now())
+	<-updated
+
+	if got := testutil.CollectAndCount(v); got != 1 {
+		t.Fatalf("got %d series, want the one updated during the sweep", got)
+	}
+	if got := testutil.ToFloat64(v.WithLabelValues("a")); got != 2 {
+		t.Errorf("g = %v, want 2", got)
+	}
+}
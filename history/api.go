@@ -0,0 +1,201 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"exporter-demo/labels"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// maxPoints 为每个序列最多返回的点数，与 Prometheus 相同
+const maxPoints = 11000
+
+type response struct {
+	Status    string `json:"status"`
+	Data      any    `json:"data,omitempty"`
+	ErrorType string `json:"errorType,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type matrixData struct {
+	ResultType string       `json:"resultType"`
+	Result     model.Matrix `json:"result"`
+}
+
+// QueryRangeHandler serves /api/v1/query_range in the Prometheus HTTP API
+// format, e.g. query=rate(x_total[5m])&start=...&end=...&step=15s.
+func (s *Store) QueryRangeHandler(w http.ResponseWriter, r *http.Request) {
+	expr, start, end, step, err := parseQueryRange(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, response{Status: "error", ErrorType: "bad_data", Error: err.Error()})
+		return
+	}
+	result := s.EvalRange(expr, start, end, step)
+	if result == nil {
+		result = model.Matrix{}
+	}
+	writeJSON(w, http.StatusOK, response{Status: "success", Data: matrixData{ResultType: "matrix", Result: result}})
+}
+
+// SeriesHandler serves /api/v1/series for one or more match[] selectors,
+// optionally limited to the series with samples between start and end.
+func (s *Store) SeriesHandler(w http.ResponseWriter, r *http.Request) {
+	mint, maxt, matcherSets, err := parseSeriesParams(r)
+	if err == nil && len(matcherSets) == 0 {
+		err = errors.New("no match[] parameter provided")
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, response{Status: "error", ErrorType: "bad_data", Error: err.Error()})
+		return
+	}
+	seen := make(map[model.Fingerprint]bool)
+	result := []model.Metric{}
+	for _, matchers := range matcherSets {
+		for _, m := range s.Series(mint, maxt, matchers...) {
+			if fp := m.Fingerprint(); !seen[fp] {
+				seen[fp] = true
+				result = append(result, m)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, response{Status: "success", Data: result})
+}
+
+// LabelValuesHandler serves /api/v1/label/{name}/values. Like
+// SeriesHandler it accepts optional match[], start and end parameters.
+func (s *Store) LabelValuesHandler(w http.ResponseWriter, r *http.Request) {
+	name := model.LabelName(r.PathValue("name"))
+	if !name.IsValid() {
+		writeJSON(w, http.StatusBadRequest, response{Status: "error", ErrorType: "bad_data", Error: fmt.Sprintf("invalid label name: %q", name)})
+		return
+	}
+	mint, maxt, matcherSets, err := parseSeriesParams(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, response{Status: "error", ErrorType: "bad_data", Error: err.Error()})
+		return
+	}
+	if len(matcherSets) == 0 {
+		writeJSON(w, http.StatusOK, response{Status: "success", Data: s.LabelValues(name, mint, maxt)})
+		return
+	}
+	seen := make(map[model.LabelValue]bool)
+	result := []model.LabelValue{}
+	for _, matchers := range matcherSets {
+		for _, v := range s.LabelValues(name, mint, maxt, matchers...) {
+			if !seen[v] {
+				seen[v] = true
+				result = append(result, v)
+			}
+		}
+	}
+	slices.Sort(result)
+	writeJSON(w, http.StatusOK, response{Status: "success", Data: result})
+}
+
+// parseSeriesParams 解析 match[] 以及可选的 start、end，未给出的时间不限制
+func parseSeriesParams(r *http.Request) (mint, maxt model.Time, matcherSets [][]*labels.Matcher, err error) {
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+	mint, maxt = model.Earliest, model.Latest
+	if v := r.FormValue("start"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid parameter \"start\": %w", err)
+		}
+		mint = model.TimeFromUnixNano(t.UnixNano())
+	}
+	if v := r.FormValue("end"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid parameter \"end\": %w", err)
+		}
+		maxt = model.TimeFromUnixNano(t.UnixNano())
+	}
+	if maxt < mint {
+		return 0, 0, nil, errors.New("invalid parameter \"end\": end timestamp must not be before start time")
+	}
+	for _, sel := range r.Form["match[]"] {
+		expr, err := ParseExpr(sel)
+		if err == nil && expr.Func != "" {
+			err = errors.New("match[] must be a series selector")
+		}
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid parameter \"match[]\": %w", err)
+		}
+		matcherSets = append(matcherSets, expr.Matchers)
+	}
+	return mint, maxt, matcherSets, nil
+}
+
+func parseQueryRange(r *http.Request) (expr *Expr, start, end time.Time, step time.Duration, err error) {
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+	if start, err = parseTime(r.FormValue("start")); err != nil {
+		err = fmt.Errorf("invalid parameter \"start\": %w", err)
+		return
+	}
+	if end, err = parseTime(r.FormValue("end")); err != nil {
+		err = fmt.Errorf("invalid parameter \"end\": %w", err)
+		return
+	}
+	if end.Before(start) {
+		err = errors.New("invalid parameter \"end\": end timestamp must not be before start time")
+		return
+	}
+	if step, err = parseDuration(r.FormValue("step")); err != nil {
+		err = fmt.Errorf("invalid parameter \"step\": %w", err)
+		return
+	}
+	if step <= 0 {
+		err = errors.New("zero or negative query resolution step widths are not accepted. Try a positive integer")
+		return
+	}
+	if end.Sub(start)/step > maxPoints {
+		err = errors.New("exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)")
+		return
+	}
+	if expr, err = ParseExpr(r.FormValue("query")); err != nil {
+		err = fmt.Errorf("invalid parameter \"query\": %w", err)
+	}
+	return
+}
+
+// parseTime 接受 Unix 秒（可带小数）或 RFC3339
+func parseTime(s string) (time.Time, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+	}
+	return t, nil
+}
+
+// parseDuration 接受秒数或 5m 形式的时长
+func parseDuration(s string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	d, err := model.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+	}
+	return time.Duration(d), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,226 @@
+package history
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// newAPITestServer 写入 base 时刻的 up{job="a"}、x_total{job="a"} 和 base+10m 的 up{job="b"}
+func newAPITestServer(t *testing.T, base time.Time) *httptest.Server {
+	t.Helper()
+	s := NewStore(24 * time.Hour)
+	at := func(d time.Duration) model.Time { return model.TimeFromUnixNano(base.Add(d).UnixNano()) }
+	s.Append(model.Vector{
+		{Metric: model.Metric{"__name__": "up", "job": "a"}, Value: 1, Timestamp: at(0)},
+		{Metric: model.Metric{"__name__": "x_total", "job": "a"}, Value: 5, Timestamp: at(0)},
+	})
+	s.Append(model.Vector{{Metric: model.Metric{"__name__": "up", "job": "b"}, Value: 1, Timestamp: at(10 * time.Minute)}})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/series", s.SeriesHandler)
+	mux.HandleFunc("/api/v1/label/{name}/values", s.LabelValuesHandler)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type apiCase struct {
+	name   string
+	path   string
+	params url.Values
+	code   int
+	data   string // 成功时 data 的 JSON
+	err    string // 失败时 error 中应包含的文本
+}
+
+func runAPICases(t *testing.T, srv *httptest.Server, cases []apiCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tc.path + "?" + tc.params.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var body struct {
+				Status    string          `json:"status"`
+				Data      json.RawMessage `json:"data"`
+				ErrorType string          `json:"errorType"`
+				Error     string          `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.code {
+				t.Fatalf("status = %d, want %d: %+v", resp.StatusCode, tc.code, body)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if tc.code != http.StatusOK {
+				if body.Status != "error" || body.ErrorType != "bad_data" || !strings.Contains(body.Error, tc.err) {
+					t.Errorf("got %+v, want a bad_data error containing %q", body, tc.err)
+				}
+				return
+			}
+			var got, want any
+			if err := json.Unmarshal(body.Data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tc.data), &want); err != nil {
+				t.Fatal(err)
+			}
+			if body.Status != "success" || !reflect.DeepEqual(got, want) {
+				t.Errorf("got %s %s, want success %s", body.Status, body.Data, tc.data)
+			}
+		})
+	}
+}
+
+func TestSeriesHandler(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	srv := newAPITestServer(t, base)
+	unix := func(d time.Duration) string { return strconv.FormatInt(base.Add(d).Unix(), 10) }
+
+	runAPICases(t, srv, []apiCase{
+		{
+			name:   "single selector",
+			path:   "/api/v1/series",
+			params: url.Values{"match[]": {"up"}},
+			code:   http.StatusOK,
+			data:   `[{"__name__": "up", "job": "a"}, {"__name__": "up", "job": "b"}]`,
+		},
+		{
+			// 多个选择器的结果去重
+			name:   "multiple selectors",
+			path:   "/api/v1/series",
+			params: url.Values{"match[]": {`up{job="a"}`, `{job=~"a"}`}},
+			code:   http.StatusOK,
+			data:   `[{"__name__": "up", "job": "a"}, {"__name__": "x_total", "job": "a"}]`,
+		},
+		{
+			name:   "start",
+			path:   "/api/v1/series",
+			params: url.Values{"match[]": {"up"}, "start": {base.Add(5 * time.Minute).Format(time.RFC3339)}},
+			code:   http.StatusOK,
+			data:   `[{"__name__": "up", "job": "b"}]`,
+		},
+		{
+			name:   "end",
+			path:   "/api/v1/series",
+			params: url.Values{"match[]": {"up"}, "end": {unix(time.Minute)}},
+			code:   http.StatusOK,
+			data:   `[{"__name__": "up", "job": "a"}]`,
+		},
+		{
+			name:   "no samples in range",
+			path:   "/api/v1/series",
+			params: url.Values{"match[]": {"up"}, "start": {unix(time.Minute)}, "end": {unix(2 * time.Minute)}},
+			code:   http.StatusOK,
+			data:   `[]`,
+		},
+		{
+			name: "missing match",
+			path: "/api/v1/series",
+			code: http.StatusBadRequest,
+			err:  "no match[] parameter provided",
+		},
+		{
+			name:   "function",
+			path:   "/api/v1/series",
+			params: url.Values{"match[]": {"rate(x_total[5m])"}},
+			code:   http.StatusBadRequest,
+			err:    "match[] must be a series selector",
+		},
+		{
+			name:   "invalid selector",
+			path:   "/api/v1/series",
+			params: url.Values{"match[]": {`up{job="a"`}},
+			code:   http.StatusBadRequest,
+			err:    `invalid parameter "match[]"`,
+		},
+		{
+			name:   "invalid start",
+			path:   "/api/v1/series",
+			params: url.Values{"match[]": {"up"}, "start": {"yesterday"}},
+			code:   http.StatusBadRequest,
+			err:    `invalid parameter "start"`,
+		},
+		{
+			name:   "end before start",
+			path:   "/api/v1/series",
+			params: url.Values{"match[]": {"up"}, "start": {unix(time.Minute)}, "end": {unix(0)}},
+			code:   http.StatusBadRequest,
+			err:    "end timestamp must not be before start time",
+		},
+	})
+}
+
+func TestLabelValuesHandler(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	srv := newAPITestServer(t, base)
+
+	runAPICases(t, srv, []apiCase{
+		{
+			name: "all series",
+			path: "/api/v1/label/job/values",
+			code: http.StatusOK,
+			data: `["a", "b"]`,
+		},
+		{
+			name: "metric names",
+			path: "/api/v1/label/__name__/values",
+			code: http.StatusOK,
+			data: `["up", "x_total"]`,
+		},
+		{
+			name: "unknown label",
+			path: "/api/v1/label/zone/values",
+			code: http.StatusOK,
+			data: `[]`,
+		},
+		{
+			name:   "match",
+			path:   "/api/v1/label/job/values",
+			params: url.Values{"match[]": {"x_total", `up{job="a"}`}},
+			code:   http.StatusOK,
+			data:   `["a"]`,
+		},
+		{
+			name:   "start",
+			path:   "/api/v1/label/job/values",
+			params: url.Values{"start": {strconv.FormatInt(base.Add(5*time.Minute).Unix(), 10)}},
+			code:   http.StatusOK,
+			data:   `["b"]`,
+		},
+		{
+			name: "invalid label name",
+			path: "/api/v1/label/1x/values",
+			code: http.StatusBadRequest,
+			err:  "invalid label name",
+		},
+		{
+			name:   "invalid selector",
+			path:   "/api/v1/label/job/values",
+			params: url.Values{"match[]": {"up{"}},
+			code:   http.StatusBadRequest,
+			err:    `invalid parameter "match[]"`,
+		},
+		{
+			name:   "invalid end",
+			path:   "/api/v1/label/job/values",
+			params: url.Values{"end": {"soon"}},
+			code:   http.StatusBadRequest,
+			err:    `invalid parameter "end"`,
+		},
+	})
+}
@@ -0,0 +1,192 @@
+package history
+
+import (
+	"math"
+	"math/bits"
+)
+
+// bstream 为按位读写的字节流
+type bstream struct {
+	b     []byte
+	count uint8 // 最后一个字节中还可写的位数
+}
+
+func (s *bstream) writeBit(bit bool) {
+	if s.count == 0 {
+		s.b = append(s.b, 0)
+		s.count = 8
+	}
+	if bit {
+		s.b[len(s.b)-1] |= 1 << (s.count - 1)
+	}
+	s.count--
+}
+
+func (s *bstream) writeBits(u uint64, n int) {
+	for n > 0 {
+		n--
+		s.writeBit(u>>uint(n)&1 == 1)
+	}
+}
+
+type bstreamReader struct {
+	b   []byte
+	pos int // 已读的位数
+}
+
+func (r *bstreamReader) readBit() bool {
+	bit := r.b[r.pos/8]>>(7-uint(r.pos%8))&1 == 1
+	r.pos++
+	return bit
+}
+
+func (r *bstreamReader) readBits(n int) uint64 {
+	var u uint64
+	for ; n > 0; n-- {
+		u <<= 1
+		if r.readBit() {
+			u |= 1
+		}
+	}
+	return u
+}
+
+// chunkSamples 为单个 chunk 最多保存的样本数
+const chunkSamples = 120
+
+// chunk 按 Gorilla 论文压缩一段样本：时间戳存二阶差分，值存与上一个值的异或
+type chunk struct {
+	b          bstream
+	num        int
+	minT, maxT int64
+
+	// 追加时需要的上一个样本的状态
+	t, delta          int64
+	v                 float64
+	leading, trailing uint8
+}
+
+// dodBuckets 为二阶差分的分段编码：前缀位数与取值位数
+var dodBuckets = []struct {
+	prefix, prefixBits uint64
+	bits               int
+}{
+	{0b10, 2, 7},
+	{0b110, 3, 9},
+	{0b1110, 4, 12},
+}
+
+func (c *chunk) append(t int64, v float64) {
+	if c.num == 0 {
+		c.b.writeBits(uint64(t), 64)
+		c.b.writeBits(math.Float64bits(v), 64)
+		c.minT, c.t, c.v = t, t, v
+		c.leading = 0xff
+	} else {
+		delta := t - c.t
+		c.writeDod(delta - c.delta)
+		c.writeValue(v)
+		c.t, c.delta, c.v = t, delta, v
+	}
+	c.maxT = t
+	c.num++
+}
+
+func (c *chunk) writeDod(dod int64) {
+	if dod == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	for _, b := range dodBuckets {
+		if -(1<<(b.bits-1))+1 <= dod && dod <= 1<<(b.bits-1) {
+			c.b.writeBits(b.prefix, int(b.prefixBits))
+			c.b.writeBits(uint64(dod), b.bits)
+			return
+		}
+	}
+	c.b.writeBits(0b1111, 4)
+	c.b.writeBits(uint64(dod), 64)
+}
+
+func (c *chunk) writeValue(v float64) {
+	xor := math.Float64bits(v) ^ math.Float64bits(c.v)
+	if xor == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	c.b.writeBit(true)
+
+	leading := uint8(bits.LeadingZeros64(xor))
+	trailing := uint8(bits.TrailingZeros64(xor))
+	if leading > 31 {
+		leading = 31
+	}
+	// 有效位落在上一个窗口内时沿用窗口，省去窗口的描述
+	if c.leading != 0xff && leading >= c.leading && trailing >= c.trailing {
+		c.b.writeBit(false)
+		c.b.writeBits(xor>>c.trailing, 64-int(c.leading)-int(c.trailing))
+		return
+	}
+	c.leading, c.trailing = leading, trailing
+	c.b.writeBit(true)
+	c.b.writeBits(uint64(leading), 5)
+	sigbits := 64 - leading - trailing
+	// 64 个有效位用 0 表示
+	c.b.writeBits(uint64(sigbits), 6)
+	c.b.writeBits(xor>>trailing, int(sigbits))
+}
+
+// samples decodes all samples of the chunk.
+func (c *chunk) samples(fn func(t int64, v float64)) {
+	r := bstreamReader{b: c.b.b}
+	var (
+		t, delta          int64
+		v                 uint64
+		leading, trailing uint8
+	)
+	for i := 0; i < c.num; i++ {
+		if i == 0 {
+			t = int64(r.readBits(64))
+			v = r.readBits(64)
+			fn(t, math.Float64frombits(v))
+			continue
+		}
+		delta += readDod(&r)
+		t += delta
+		if r.readBit() {
+			if r.readBit() {
+				leading = uint8(r.readBits(5))
+				sigbits := uint8(r.readBits(6))
+				if sigbits == 0 {
+					sigbits = 64
+				}
+				trailing = 64 - leading - sigbits
+			}
+			v ^= r.readBits(64-int(leading)-int(trailing)) << trailing
+		}
+		fn(t, math.Float64frombits(v))
+	}
+}
+
+func readDod(r *bstreamReader) int64 {
+	if !r.readBit() {
+		return 0
+	}
+	// 前缀 10、110、1110 依次对应 dodBuckets，1111 为 64 位原值
+	n := 0
+	for _, b := range dodBuckets {
+		if !r.readBit() {
+			n = b.bits
+			break
+		}
+	}
+	if n == 0 {
+		return int64(r.readBits(64))
+	}
+	u := r.readBits(n)
+	// 按 n 位有符号数还原
+	if u > 1<<(n-1) {
+		return int64(u) - 1<<n
+	}
+	return int64(u)
+}
@@ -0,0 +1,117 @@
+package history
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+type sample struct {
+	t int64
+	v float64
+}
+
+// staleNaN 为 Prometheus 标记序列消失使用的 NaN
+var staleNaN = math.Float64frombits(0x7ff0000000000002)
+
+func roundTrip(t *testing.T, in []sample) {
+	t.Helper()
+	var c chunk
+	for _, s := range in {
+		c.append(s.t, s.v)
+	}
+	var out []sample
+	c.samples(func(t int64, v float64) { out = append(out, sample{t, v}) })
+	if len(out) != len(in) {
+		t.Fatalf("decoded %d samples, want %d", len(out), len(in))
+	}
+	for i := range in {
+		// 按位比较，NaN 的具体取值也要保留
+		if out[i].t != in[i].t || math.Float64bits(out[i].v) != math.Float64bits(in[i].v) {
+			t.Fatalf("sample %d = (%d, %v), want (%d, %v)", i, out[i].t, out[i].v, in[i].t, in[i].v)
+		}
+	}
+	if c.minT != in[0].t || c.maxT != in[len(in)-1].t {
+		t.Errorf("minT, maxT = %d, %d; want %d, %d", c.minT, c.maxT, in[0].t, in[len(in)-1].t)
+	}
+}
+
+func TestChunkRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   []sample
+	}{
+		{"single", []sample{{1000, 1}}},
+		{"regular", []sample{{0, 1}, {15000, 2}, {30000, 3}, {45000, 3}, {60000, 2.5}}},
+		{"negative first timestamp", []sample{{-5000, 1}, {0, 2}}},
+		{
+			// 依次落入 7、9、12 位分段和 64 位原值，包括各分段的边界
+			"delta of delta buckets",
+			[]sample{
+				{0, 0}, {1000, 0}, {2064, 0}, {3001, 0}, {4257, 0}, {5000, 0}, {7048, 0}, {7049, 0},
+				{9050, 0}, {9051, 0}, {1 << 40, 0}, {1<<40 + 1, 0}, {1 << 50, 0},
+			},
+		},
+		{"large negative delta of delta", []sample{{0, 0}, {1 << 45, 0}, {1<<45 + 1, 0}, {1<<45 + 2, 0}}},
+		{"NaN and stale", []sample{{0, 1}, {1, math.NaN()}, {2, staleNaN}, {3, 1}, {4, staleNaN}, {5, math.Inf(-1)}}},
+		{
+			// 异或结果的 64 位全部有效，窗口长度编码为 0
+			"full 64-bit XOR",
+			[]sample{{0, math.Float64frombits(0)}, {1, math.Float64frombits(math.MaxUint64)}, {2, math.Float64frombits(1)}, {3, math.Copysign(0, -1)}},
+		},
+		{"leading zeros above 31", []sample{{0, math.Float64frombits(0)}, {1, math.Float64frombits(1)}, {2, math.Float64frombits(3)}, {3, math.Float64frombits(1 << 20)}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			roundTrip(t, tc.in)
+		})
+	}
+}
+
+func TestChunkRoundTripFull(t *testing.T) {
+	in := make([]sample, chunkSamples)
+	for i := range in {
+		// 抖动的采集间隔和缓慢变化的值，覆盖沿用窗口的分支
+		in[i] = sample{int64(i)*15000 + int64(i%7)*13, float64(i)*0.1 + float64(i%3)}
+	}
+	roundTrip(t, in)
+}
+
+func TestStoreSelect(t *testing.T) {
+	s := NewStore(24 * time.Hour)
+	base := model.Now()
+	a := model.Metric{"__name__": "x", "job": "a"}
+	b := model.Metric{"__name__": "x", "job": "b"}
+	// 超过一个 chunk 的样本，Select 需要跨 chunk 读取
+	for i := 0; i < chunkSamples+10; i++ {
+		ts := base.Add(-time.Duration(chunkSamples+10-i) * 15 * time.Second)
+		s.Append(model.Vector{
+			{Metric: a, Value: model.SampleValue(i), Timestamp: ts},
+			{Metric: b, Value: model.SampleValue(-i), Timestamp: ts},
+		})
+	}
+	// 时间戳不递增的样本被丢弃
+	s.Append(model.Vector{{Metric: a, Value: 1000, Timestamp: base.Add(-5 * 15 * time.Second)}})
+
+	expr, err := ParseExpr(`x{job="a"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mint, maxt := base.Add(-15*15*time.Second), base.Add(-5*15*time.Second)
+	m := s.Select(mint, maxt, expr.Matchers...)
+	if len(m) != 1 || !m[0].Metric.Equal(a) {
+		t.Fatalf("Select() = %v, want only job=a", m)
+	}
+	if n := len(m[0].Values); n != 11 {
+		t.Fatalf("got %d samples, want 11", n)
+	}
+	for i, v := range m[0].Values {
+		if v.Timestamp < mint || v.Timestamp > maxt {
+			t.Errorf("sample %d at %v outside [%v, %v]", i, v.Timestamp, mint, maxt)
+		}
+		if want := model.SampleValue(chunkSamples + 10 - 15 + i); v.Value != want {
+			t.Errorf("sample %d = %v, want %v", i, v.Value, want)
+		}
+	}
+}
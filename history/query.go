@@ -0,0 +1,205 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"exporter-demo/labels"
+
+	"github.com/prometheus/common/model"
+)
+
+// Expr 为支持的查询：一个选择器，或对区间选择器求 rate 或 increase
+type Expr struct {
+	Func     string // 为空表示直接取选择器的值
+	Matchers []*labels.Matcher
+	Range    time.Duration
+}
+
+// functions 为支持的函数，均只接受计数器的区间选择器
+var functions = map[string]bool{"rate": true, "increase": true}
+
+// ParseExpr parses a selector like up{job=~"node.*"} or rate(x_total[5m]).
+func ParseExpr(input string) (*Expr, error) {
+	p := &parser{input: input}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, fmt.Errorf("parse error at char %d: %w", p.pos+1, err)
+	}
+	return expr, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) parseExpr() (*Expr, error) {
+	p.skipSpace()
+	start := p.pos
+	name := p.ident()
+	p.skipSpace()
+
+	if functions[name] && p.consume("(") {
+		p.skipSpace()
+		expr, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		if expr.Range == 0 {
+			return nil, fmt.Errorf("%s() needs a range selector like x[5m]", name)
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, fmt.Errorf("expected )")
+		}
+		expr.Func = name
+		return expr, p.end()
+	}
+
+	p.pos = start
+	expr, err := p.parseSelector()
+	if err != nil {
+		return nil, err
+	}
+	if expr.Range != 0 {
+		return nil, fmt.Errorf("range selectors are only supported inside rate() and increase()")
+	}
+	return expr, p.end()
+}
+
+// parseSelector 解析选择器及可选的区间，选择器语法与 derive 相同
+func (p *parser) parseSelector() (*Expr, error) {
+	matchers, n, err := labels.ParseSelector(p.input[p.pos:])
+	if err != nil {
+		var perr *labels.ParseError
+		if errors.As(err, &perr) {
+			p.pos += perr.Pos
+		}
+		return nil, err
+	}
+	p.pos += n
+	expr := &Expr{Matchers: matchers}
+
+	p.skipSpace()
+	if p.consume("[") {
+		end := strings.IndexByte(p.input[p.pos:], ']')
+		if end < 0 {
+			return nil, fmt.Errorf("expected ]")
+		}
+		d, err := model.ParseDuration(strings.TrimSpace(p.input[p.pos : p.pos+end]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid range %q", p.input[p.pos:p.pos+end])
+		}
+		expr.Range = time.Duration(d)
+		p.pos += end + 1
+	}
+	return expr, nil
+}
+
+func (p *parser) ident() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := rune(p.input[p.pos])
+		if c == '_' || c == ':' || unicode.IsLetter(c) && c < unicode.MaxASCII || p.pos > start && unicode.IsDigit(c) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *parser) consume(s string) bool {
+	if strings.HasPrefix(p.input[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) end() error {
+	p.skipSpace()
+	if p.pos != len(p.input) {
+		return fmt.Errorf("unexpected %q", p.input[p.pos:])
+	}
+	return nil
+}
+
+// lookbackDelta 为选择器在求值时刻向前查找最近样本的范围，与 Prometheus 默认值相同
+const lookbackDelta = 5 * time.Minute
+
+// EvalRange evaluates expr at every step between start and end.
+func (s *Store) EvalRange(expr *Expr, start, end time.Time, step time.Duration) model.Matrix {
+	window := lookbackDelta
+	if expr.Func != "" {
+		window = expr.Range
+	}
+	data := s.Select(model.TimeFromUnixNano(start.Add(-window).UnixNano()), model.TimeFromUnixNano(end.UnixNano()), expr.Matchers...)
+
+	var result model.Matrix
+	for _, ss := range data {
+		out := &model.SampleStream{Metric: ss.Metric}
+		if expr.Func != "" {
+			// 函数结果不再是原来的指标，去掉指标名
+			out.Metric = ss.Metric.Clone()
+			delete(out.Metric, model.MetricNameLabel)
+		}
+		for t := start; !t.After(end); t = t.Add(step) {
+			ts := model.TimeFromUnixNano(t.UnixNano())
+			v, ok := eval(expr, ss.Values, ts, window)
+			if ok {
+				out.Values = append(out.Values, model.SamplePair{Timestamp: ts, Value: v})
+			}
+		}
+		if len(out.Values) > 0 {
+			result = append(result, out)
+		}
+	}
+	return result
+}
+
+// eval 计算 t 时刻的值，samples 按时间排序
+func eval(expr *Expr, samples []model.SamplePair, t model.Time, window time.Duration) (model.SampleValue, bool) {
+	mint := t.Add(-window)
+	// 窗口为左开右闭区间 (t-window, t]
+	lo := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp > mint })
+	hi := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp > t })
+	in := samples[lo:hi]
+
+	if expr.Func == "" {
+		if len(in) == 0 {
+			return 0, false
+		}
+		return in[len(in)-1].Value, true
+	}
+
+	// 计数器重置后从 0 重新累加，把重置前的值补回去
+	if len(in) < 2 {
+		return 0, false
+	}
+	var increase model.SampleValue
+	for i := 1; i < len(in); i++ {
+		if d := in[i].Value - in[i-1].Value; d >= 0 {
+			increase += d
+		} else {
+			increase += in[i].Value
+		}
+	}
+	// 不做 Prometheus 那样的区间外推，按首尾样本的实际间隔计算
+	rate := increase / model.SampleValue(in[len(in)-1].Timestamp.Sub(in[0].Timestamp).Seconds())
+	if expr.Func == "increase" {
+		return rate * model.SampleValue(window.Seconds()), true
+	}
+	return rate, true
+}
@@ -0,0 +1,160 @@
+package history
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestParseExpr(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		fn       string
+		matchers string
+		rng      time.Duration
+		err      string
+	}{
+		{input: `up`, matchers: `__name__="up"`},
+		{input: ` up { job = "node" , instance!~'a.*' } `, matchers: `__name__="up" job="node" instance!~"a.*"`},
+		{input: `{__name__=~"x_.*"}`, matchers: `__name__=~"x_.*"`},
+		{input: "x{a=`b\\c`}", matchers: `__name__="x" a="b\\c"`},
+		{input: `rate(x_total[5m])`, fn: "rate", matchers: `__name__="x_total"`, rng: 5 * time.Minute},
+		{input: `increase( x_total{a="b"} [1h] )`, fn: "increase", matchers: `__name__="x_total" a="b"`, rng: time.Hour},
+		{input: `x[5m]`, err: "only supported inside rate()"},
+		{input: `rate(x_total)`, err: "needs a range selector"},
+		{input: `rate(x_total[5m]`, err: "char 17: expected )"},
+		{input: `x{a="b"`, err: "char 8: expected , or }"},
+		{input: `x{a=b}`, err: "char 5: expected a quoted string"},
+		{input: `x{a=="b"}`, err: "char 5: expected a quoted string"},
+		{input: `x{a="b}`, err: "unterminated string"},
+		{input: `x{a=~"("}`, err: "invalid regex"},
+		{input: `{a=""}`, err: "at least one matcher that does not match the empty string"},
+		{input: `x[0s]`, err: "invalid range"},
+		{input: `x y`, err: "char 3: unexpected \"y\""},
+		{input: ``, err: "expected a metric name"},
+	} {
+		expr, err := ParseExpr(tc.input)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("ParseExpr(%q) error = %v, want %q", tc.input, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseExpr(%q): %v", tc.input, err)
+			continue
+		}
+		var ms []string
+		for _, m := range expr.Matchers {
+			ms = append(ms, m.Name+string(m.Type)+`"`+strings.ReplaceAll(m.Value, `\`, `\\`)+`"`)
+		}
+		if got := strings.Join(ms, " "); got != tc.matchers || expr.Func != tc.fn || expr.Range != tc.rng {
+			t.Errorf("ParseExpr(%q) = %s %s [%v], want %s %s [%v]", tc.input, expr.Func, got, expr.Range, tc.fn, tc.matchers, tc.rng)
+		}
+	}
+}
+
+// newTestStore 写入 x_total 每 15 秒一个样本，第 10 个样本处计数器重置
+func newTestStore(base time.Time) *Store {
+	s := NewStore(24 * time.Hour)
+	metric := model.Metric{"__name__": "x_total", "job": "a"}
+	for i := 0; i < 40; i++ {
+		v := float64(i * 10)
+		if i >= 10 {
+			v = float64((i - 10) * 10)
+		}
+		s.Append(model.Vector{{
+			Metric:    metric,
+			Value:     model.SampleValue(v),
+			Timestamp: model.TimeFromUnixNano(base.Add(time.Duration(i) * 15 * time.Second).UnixNano()),
+		}})
+	}
+	return s
+}
+
+func evalRange(t *testing.T, s *Store, input string, start, end time.Time, step time.Duration) []model.SamplePair {
+	t.Helper()
+	expr, err := ParseExpr(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := s.EvalRange(expr, start, end, step)
+	if len(m) == 0 {
+		return nil
+	}
+	if len(m) != 1 {
+		t.Fatalf("EvalRange(%q) returned %d series, want 1", input, len(m))
+	}
+	return m[0].Values
+}
+
+func TestEvalRangeSelector(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	s := newTestStore(base)
+
+	// 步长不与样本对齐时取每个时刻之前最近的样本
+	got := evalRange(t, s, `x_total{job="a"}`, base.Add(20*time.Second), base.Add(80*time.Second), 20*time.Second)
+	want := []model.SamplePair{
+		{Timestamp: model.TimeFromUnixNano(base.Add(20 * time.Second).UnixNano()), Value: 10},
+		{Timestamp: model.TimeFromUnixNano(base.Add(40 * time.Second).UnixNano()), Value: 20},
+		{Timestamp: model.TimeFromUnixNano(base.Add(60 * time.Second).UnixNano()), Value: 40},
+		{Timestamp: model.TimeFromUnixNano(base.Add(80 * time.Second).UnixNano()), Value: 50},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(&want[i]) {
+			t.Errorf("point %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// 指标名保留，区间之前没有样本的时刻不输出
+	expr, _ := ParseExpr(`x_total`)
+	m := s.EvalRange(expr, base.Add(-time.Minute), base, 30*time.Second)
+	if len(m) != 1 || m[0].Metric["__name__"] != "x_total" || len(m[0].Values) != 1 {
+		t.Fatalf("EvalRange() = %v, want a single point at base", m)
+	}
+
+	// 最后一个样本在 5 分钟回看窗口内有效，之后消失
+	last := base.Add(39 * 15 * time.Second)
+	got = evalRange(t, s, `x_total`, last.Add(4*time.Minute), last.Add(6*time.Minute), time.Minute)
+	if len(got) != 1 || got[0].Value != 290 {
+		t.Errorf("got %v, want only the point within the lookback window", got)
+	}
+}
+
+func TestEvalRangeRate(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	s := newTestStore(base)
+
+	// 重置前：每 15 秒增加 10
+	at := base.Add(2 * time.Minute)
+	got := evalRange(t, s, `rate(x_total[1m])`, at, at, time.Minute)
+	if len(got) != 1 || math.Abs(float64(got[0].Value)-10.0/15) > 1e-9 {
+		t.Errorf("rate before reset = %v, want %v", got, 10.0/15)
+	}
+
+	// 窗口跨过重置：第 9 个样本为 90，第 10 个从 0 开始，重置处补回 0
+	at = base.Add(10*15*time.Second + 30*time.Second)
+	got = evalRange(t, s, `increase(x_total[1m])`, at, at, time.Minute)
+	// (120s, 180s] 内的样本为 90、0、10、20，增量 0+10+10=20，按 45s 的实际跨度换算到 1m
+	if len(got) != 1 || math.Abs(float64(got[0].Value)-20.0/45*60) > 1e-9 {
+		t.Errorf("increase across reset = %v, want %v", got, 20.0/45*60)
+	}
+	// 函数结果去掉指标名
+	expr, _ := ParseExpr(`rate(x_total[1m])`)
+	m := s.EvalRange(expr, at, at, time.Minute)
+	if _, ok := m[0].Metric["__name__"]; ok || m[0].Metric["job"] != "a" {
+		t.Errorf("rate() labels = %v, want job only", m[0].Metric)
+	}
+
+	// 窗口内只有一个样本时没有结果
+	got = evalRange(t, s, `rate(x_total[10s])`, at, at, time.Minute)
+	if len(got) != 0 {
+		t.Errorf("rate over a single sample = %v, want none", got)
+	}
+}
@@ -0,0 +1,206 @@
+// Package history keeps recent samples of the exporter in memory and serves
+// them through a subset of the Prometheus query_range API.
+package history
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"exporter-demo/labels"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// Config 为历史数据的配置
+type Config struct {
+	Enabled   bool           `yaml:"enabled"`
+	Retention model.Duration `yaml:"retention"` // 保留时长
+	Interval  model.Duration `yaml:"interval"`  // 采样间隔
+}
+
+// DefaultConfig 默认关闭，开启后保留 3 小时、每 15 秒采样一次
+var DefaultConfig = Config{
+	Enabled:   false,
+	Retention: model.Duration(3 * time.Hour),
+	Interval:  model.Duration(15 * time.Second),
+}
+
+type series struct {
+	metric model.Metric
+	chunks []*chunk
+}
+
+// Store 保存每个序列的压缩样本
+type Store struct {
+	mu        sync.RWMutex
+	retention time.Duration
+	series    map[model.Fingerprint]*series
+}
+
+func NewStore(retention time.Duration) *Store {
+	return &Store{retention: retention, series: make(map[model.Fingerprint]*series)}
+}
+
+// SetRetention changes the retention, e.g. after a config reload.
+func (s *Store) SetRetention(retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = retention
+}
+
+// Reset drops all samples.
+func (s *Store) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.series = make(map[model.Fingerprint]*series)
+}
+
+// Append adds samples of the same timestamp and drops data older than the
+// retention.
+func (s *Store) Append(samples model.Vector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, smpl := range samples {
+		fp := smpl.Metric.Fingerprint()
+		sr, ok := s.series[fp]
+		if !ok {
+			sr = &series{metric: smpl.Metric}
+			s.series[fp] = sr
+		}
+		t := int64(smpl.Timestamp)
+		if n := len(sr.chunks); n > 0 && sr.chunks[n-1].maxT >= t {
+			continue // 时间戳必须递增
+		}
+		if n := len(sr.chunks); n == 0 || sr.chunks[n-1].num >= chunkSamples {
+			sr.chunks = append(sr.chunks, &chunk{})
+		}
+		sr.chunks[len(sr.chunks)-1].append(t, float64(smpl.Value))
+	}
+	s.truncate(time.Now().Add(-s.retention))
+}
+
+func (s *Store) truncate(before time.Time) {
+	mint := before.UnixMilli()
+	for fp, sr := range s.series {
+		i := 0
+		for i < len(sr.chunks) && sr.chunks[i].maxT < mint {
+			i++
+		}
+		sr.chunks = sr.chunks[i:]
+		if len(sr.chunks) == 0 {
+			delete(s.series, fp)
+		}
+	}
+}
+
+// Select returns the samples between mint and maxt of all series matching
+// every matcher, sorted by labels.
+func (s *Store) Select(mint, maxt model.Time, matchers ...*labels.Matcher) model.Matrix {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result model.Matrix
+	for _, sr := range s.series {
+		if !labels.MatchesAll(sr.metric, matchers) {
+			continue
+		}
+		ss := &model.SampleStream{Metric: sr.metric}
+		for _, c := range sr.chunks {
+			if c.maxT < int64(mint) || c.minT > int64(maxt) {
+				continue
+			}
+			c.samples(func(t int64, v float64) {
+				if t >= int64(mint) && t <= int64(maxt) {
+					ss.Values = append(ss.Values, model.SamplePair{Timestamp: model.Time(t), Value: model.SampleValue(v)})
+				}
+			})
+		}
+		if len(ss.Values) > 0 {
+			result = append(result, ss)
+		}
+	}
+	sort.Sort(result)
+	return result
+}
+
+// Series returns the label sets of all series matching every matcher that
+// have samples between mint and maxt.
+func (s *Store) Series(mint, maxt model.Time, matchers ...*labels.Matcher) []model.Metric {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []model.Metric
+	for _, sr := range s.series {
+		if labels.MatchesAll(sr.metric, matchers) && sr.hasSamples(mint, maxt) {
+			result = append(result, sr.metric)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].String() < result[j].String() })
+	return result
+}
+
+// LabelValues returns the sorted values of label name over the series
+// matching every matcher that have samples between mint and maxt.
+func (s *Store) LabelValues(name model.LabelName, mint, maxt model.Time, matchers ...*labels.Matcher) []model.LabelValue {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[model.LabelValue]bool)
+	result := []model.LabelValue{}
+	for _, sr := range s.series {
+		v, ok := sr.metric[name]
+		if !ok || seen[v] || !labels.MatchesAll(sr.metric, matchers) || !sr.hasSamples(mint, maxt) {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// hasSamples 判断序列在 mint 和 maxt 之间是否有样本，只解码跨越边界的 chunk
+func (sr *series) hasSamples(mint, maxt model.Time) bool {
+	for _, c := range sr.chunks {
+		if c.maxT < int64(mint) || c.minT > int64(maxt) {
+			continue
+		}
+		if c.minT >= int64(mint) || c.maxT <= int64(maxt) {
+			return true
+		}
+		found := false
+		c.samples(func(t int64, _ float64) {
+			found = found || t >= int64(mint) && t <= int64(maxt)
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// Record gathers g every interval and appends the samples until ctx is done.
+func (s *Store) Record(ctx context.Context, g prometheus.Gatherer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.record(g)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Store) record(g prometheus.Gatherer) {
+	// Gather 出错时仍会返回其余指标，照常保存
+	mfs, _ := g.Gather()
+	samples, _ := expfmt.ExtractSamples(&expfmt.DecodeOptions{Timestamp: model.Now()}, mfs...)
+	s.Append(samples)
+}
@@ -0,0 +1,65 @@
+// Package labels holds the label matchers and the series selector syntax
+// shared by the query languages of history and derive.
+package labels
+
+import (
+	"regexp"
+
+	"github.com/prometheus/common/model"
+)
+
+// MatchType 为标签匹配方式
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// Matcher 为选择器中的一个标签条件，正则与 PromQL 一样整体锚定
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+	re    *regexp.Regexp
+}
+
+func NewMatcher(name string, t MatchType, value string) (*Matcher, error) {
+	m := &Matcher{Name: name, Type: t, Value: value}
+	if t == MatchRegexp || t == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, err
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether the label value v satisfies the matcher. A
+// missing label has the empty value.
+func (m *Matcher) Matches(v string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+// MatchesAll reports whether metric satisfies every matcher.
+func MatchesAll(metric model.Metric, matchers []*Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(string(metric[model.LabelName(m.Name)])) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,170 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/common/model"
+)
+
+// ParseError 为选择器的语法错误，Pos 为出错处相对输入开头的字节偏移
+type ParseError struct {
+	Pos int
+	Err error
+}
+
+func (e *ParseError) Error() string { return e.Err.Error() }
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// ParseSelector parses the series selector at the start of input: an
+// optional metric name followed by optional label matchers in braces, such
+// as up{job=~"node.*", mode!='idle'}. Like PromQL, at least one matcher must
+// not match the empty string. It returns the matchers and the number of
+// bytes consumed; errors are *ParseError.
+func ParseSelector(input string) ([]*Matcher, int, error) {
+	p := &selectorParser{input: input}
+	matchers, err := p.selector()
+	if err != nil {
+		return nil, 0, &ParseError{Pos: p.pos, Err: err}
+	}
+	return matchers, p.pos, nil
+}
+
+// ParseString parses the single-, double- or backtick-quoted string at the
+// start of input and returns its value and the number of bytes consumed.
+// Escapes follow Go, and \' is allowed in single-quoted strings.
+func ParseString(input string) (string, int, error) {
+	if input == "" || !strings.ContainsRune("\"'`", rune(input[0])) {
+		return "", 0, &ParseError{Err: errors.New("expected a quoted string")}
+	}
+	quote := input[0]
+	end := 1
+	for ; end < len(input) && input[end] != quote; end++ {
+		if input[end] == '\\' && quote != '`' {
+			end++
+		}
+	}
+	if end >= len(input) {
+		return "", 0, &ParseError{Err: errors.New("unterminated string")}
+	}
+	raw := input[:end+1]
+	if quote == '\'' {
+		// 转成双引号字符串后交给 strconv 处理转义
+		raw = `"` + strings.ReplaceAll(strings.ReplaceAll(raw[1:end], `\'`, `'`), `"`, `\"`) + `"`
+	}
+	s, err := strconv.Unquote(raw)
+	if err != nil {
+		return "", 0, &ParseError{Err: fmt.Errorf("invalid string %s", input[:end+1])}
+	}
+	return s, end + 1, nil
+}
+
+type selectorParser struct {
+	input string
+	pos   int
+}
+
+func (p *selectorParser) selector() ([]*Matcher, error) {
+	var matchers []*Matcher
+	end := p.pos
+	if name := p.ident(); name != "" {
+		m, _ := NewMatcher(model.MetricNameLabel, MatchEqual, name)
+		matchers = append(matchers, m)
+		end = p.pos
+	}
+	p.skipSpace()
+	if !p.consume("{") {
+		// 没有标签条件时不吞掉名称后的空白
+		p.pos = end
+	} else {
+		for {
+			p.skipSpace()
+			if p.consume("}") {
+				break
+			}
+			m, err := p.matcher()
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, m)
+			p.skipSpace()
+			if p.consume(",") {
+				continue
+			}
+			if !p.consume("}") {
+				return nil, errors.New("expected , or }")
+			}
+			break
+		}
+	}
+	if len(matchers) == 0 {
+		return nil, errors.New("expected a metric name or label matchers")
+	}
+	for _, m := range matchers {
+		if !m.Matches("") {
+			return matchers, nil
+		}
+	}
+	return nil, errors.New("selector must contain at least one matcher that does not match the empty string")
+}
+
+func (p *selectorParser) matcher() (*Matcher, error) {
+	name := p.ident()
+	if !model.LabelName(name).IsValid() {
+		p.pos -= len(name)
+		return nil, errors.New("expected a label name")
+	}
+	p.skipSpace()
+	var t MatchType
+	for _, op := range []MatchType{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+		if p.consume(string(op)) {
+			t = op
+			break
+		}
+	}
+	if t == "" {
+		return nil, errors.New("expected one of =, !=, =~, !~")
+	}
+	p.skipSpace()
+	value, n, err := ParseString(p.input[p.pos:])
+	if err != nil {
+		return nil, errors.Unwrap(err)
+	}
+	m, err := NewMatcher(name, t, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", value, err)
+	}
+	p.pos += n
+	return m, nil
+}
+
+func (p *selectorParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := rune(p.input[p.pos])
+		if c == '_' || c == ':' || unicode.IsLetter(c) && c < unicode.MaxASCII || p.pos > start && unicode.IsDigit(c) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *selectorParser) consume(s string) bool {
+	if strings.HasPrefix(p.input[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *selectorParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
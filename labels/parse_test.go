@@ -0,0 +1,109 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseString(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  string
+		n     int
+		err   string
+	}{
+		{input: `"a\"b" rest`, want: `a"b`, n: 6},
+		{input: `'a\'b"c'`, want: `a'b"c`, n: 8},
+		{input: "`a\\d+`", want: `a\d+`, n: 6},
+		{input: `"é\n"`, want: "é\n", n: 6},
+		{input: `'\x'`, err: `invalid string '\x'`},
+		{input: `"abc`, err: "unterminated string"},
+		{input: `abc`, err: "expected a quoted string"},
+		{input: ``, err: "expected a quoted string"},
+	} {
+		got, n, err := ParseString(tc.input)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("ParseString(%q) error = %v, want %q", tc.input, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want || n != tc.n {
+			t.Errorf("ParseString(%q) = %q, %d, %v, want %q, %d", tc.input, got, n, err, tc.want, tc.n)
+		}
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  string // 各条件按 name op value 格式化
+		n     int
+		err   string
+		pos   int
+	}{
+		{input: `up`, want: `__name__="up"`, n: 2},
+		{input: `up [5m]`, want: `__name__="up"`, n: 2},
+		{input: `up {job="a"} / 2`, want: `__name__="up" job="a"`, n: 12},
+		{input: `{ job = 'a', mode!="idle", cpu=~` + "`0|1`" + `, x!~"y", }`, want: `job="a" mode!="idle" cpu=~"0|1" x!~"y"`, n: 48},
+		{input: `node:cpu:rate5m{}`, want: `__name__="node:cpu:rate5m"`, n: 17},
+		{input: ``, err: "expected a metric name or label matchers"},
+		{input: `{}`, err: "expected a metric name or label matchers", pos: 2},
+		{input: `{job=""}`, err: "at least one matcher that does not match the empty string", pos: 8},
+		{input: `up{job="a"`, err: "expected , or }", pos: 10},
+		{input: `up{job=a}`, err: "expected a quoted string", pos: 7},
+		{input: `up{job=="a"}`, err: "expected a quoted string", pos: 7},
+		{input: `up{job~"a"}`, err: "expected one of =, !=, =~, !~", pos: 6},
+		{input: `up{a:b="x"}`, err: "expected a label name", pos: 3},
+		{input: `up{job="a}`, err: "unterminated string", pos: 7},
+		{input: `up{job=~"("}`, err: `invalid regex "("`, pos: 8},
+	} {
+		ms, n, err := ParseSelector(tc.input)
+		if tc.err != "" {
+			var perr *ParseError
+			if !errors.As(err, &perr) || !strings.Contains(err.Error(), tc.err) || perr.Pos != tc.pos {
+				t.Errorf("ParseSelector(%q) error = %#v, want %q at %d", tc.input, err, tc.err, tc.pos)
+			}
+			continue
+		}
+		var got []string
+		for _, m := range ms {
+			got = append(got, fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value))
+		}
+		if err != nil || strings.Join(got, " ") != tc.want || n != tc.n {
+			t.Errorf("ParseSelector(%q) = %s, %d, %v, want %s, %d", tc.input, got, n, err, tc.want, tc.n)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	for _, tc := range []struct {
+		t     MatchType
+		value string
+		in    []string
+		out   []string
+	}{
+		{MatchEqual, "a", []string{"a"}, []string{"", "ab"}},
+		{MatchNotEqual, "a", []string{"", "ab"}, []string{"a"}},
+		// 正则整体锚定
+		{MatchRegexp, "a|b", []string{"a", "b"}, []string{"ab", "xa", ""}},
+		{MatchNotRegexp, "a.*", []string{"", "ba"}, []string{"a", "abc"}},
+	} {
+		m, err := NewMatcher("l", tc.t, tc.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range tc.in {
+			if !m.Matches(v) {
+				t.Errorf("l%s%q does not match %q", tc.t, tc.value, v)
+			}
+		}
+		for _, v := range tc.out {
+			if m.Matches(v) {
+				t.Errorf("l%s%q matches %q", tc.t, tc.value, v)
+			}
+		}
+	}
+}
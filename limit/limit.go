@@ -0,0 +1,153 @@
+// Package limit caps the number of label sets a metric vector can create.
+package limit
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OverflowValue 为超出上限的序列统一使用的标签值
+const OverflowValue = "__overflow__"
+
+// maxDropped 为记住的被丢弃标签组合的上限，超过后清空重新记录，
+// 此时重复出现的组合可能再被计数一次
+const maxDropped = 10000
+
+// labelVec 为 CounterVec、GaugeVec、HistogramVec 等的公共部分
+type labelVec[T any] interface {
+	prometheus.Collector
+	WithLabelValues(lvs ...string) T
+	With(labels prometheus.Labels) T
+	Delete(labels prometheus.Labels) bool
+}
+
+// Vec 包装一个指标向量，最多创建 limit 个不同的标签组合，
+// 之后新出现的组合全部计入所有标签值为 OverflowValue 的序列。
+// 被丢弃的组合数记在 cardinality_overflow_total 中，其 metric 标签为向量带
+// namespace 和 subsystem 的完整指标名。
+type Vec[T any] struct {
+	vec        labelVec[T]
+	labelNames []string
+	limit      int
+	overflow   prometheus.Counter
+
+	mu      sync.Mutex
+	seen    map[string]struct{}
+	dropped map[string]struct{} // 已计入 overflow 的标签组合
+}
+
+// NewCounterVec is like prometheus.NewCounterVec with at most limit label sets.
+func NewCounterVec(opts prometheus.CounterOpts, labelNames []string, limit int) *Vec[prometheus.Counter] {
+	name := prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)
+	return newVec[prometheus.Counter](prometheus.NewCounterVec(opts, labelNames), name, labelNames, limit)
+}
+
+// NewGaugeVec is like prometheus.NewGaugeVec with at most limit label sets.
+func NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string, limit int) *Vec[prometheus.Gauge] {
+	name := prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)
+	return newVec[prometheus.Gauge](prometheus.NewGaugeVec(opts, labelNames), name, labelNames, limit)
+}
+
+// NewHistogramVec is like prometheus.NewHistogramVec with at most limit label sets.
+func NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string, limit int) *Vec[prometheus.Observer] {
+	name := prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)
+	return newVec[prometheus.Observer](prometheus.NewHistogramVec(opts, labelNames), name, labelNames, limit)
+}
+
+func newVec[T any](vec labelVec[T], name string, labelNames []string, limit int) *Vec[T] {
+	return &Vec[T]{
+		vec:        vec,
+		labelNames: labelNames,
+		limit:      limit,
+		overflow: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "cardinality_overflow_total",
+			Help:        "Distinct label sets that exceeded the cardinality limit and went to the overflow series.",
+			ConstLabels: prometheus.Labels{"metric": name},
+		}),
+		seen:    make(map[string]struct{}),
+		dropped: make(map[string]struct{}),
+	}
+}
+
+// WithLabelValues returns the series for lvs, or the overflow series once
+// the limit of distinct label sets is reached.
+func (v *Vec[T]) WithLabelValues(lvs ...string) T {
+	if len(lvs) != len(v.labelNames) {
+		// 标签数量不对时交给原始向量 panic，与 prometheus 行为一致
+		return v.vec.WithLabelValues(lvs...)
+	}
+	return v.vec.WithLabelValues(v.admit(lvs)...)
+}
+
+// With is like WithLabelValues with the values given by name.
+func (v *Vec[T]) With(labels prometheus.Labels) T {
+	lvs := make([]string, 0, len(v.labelNames))
+	for _, name := range v.labelNames {
+		if lv, ok := labels[name]; ok {
+			lvs = append(lvs, lv)
+		}
+	}
+	if len(labels) != len(v.labelNames) || len(lvs) != len(v.labelNames) {
+		return v.vec.With(labels)
+	}
+	return v.vec.WithLabelValues(v.admit(lvs)...)
+}
+
+func (v *Vec[T]) admit(lvs []string) []string {
+	key := strings.Join(lvs, "\xff")
+
+	v.mu.Lock()
+	_, ok := v.seen[key]
+	if !ok && len(v.seen) < v.limit {
+		v.seen[key] = struct{}{}
+		ok = true
+	}
+	newlyDropped := false
+	if !ok {
+		if _, dup := v.dropped[key]; !dup {
+			if len(v.dropped) >= maxDropped {
+				clear(v.dropped)
+			}
+			v.dropped[key] = struct{}{}
+			newlyDropped = true
+		}
+	}
+	v.mu.Unlock()
+	if ok {
+		return lvs
+	}
+
+	if newlyDropped {
+		v.overflow.Inc()
+	}
+	overflow := make([]string, len(lvs))
+	for i := range overflow {
+		overflow[i] = OverflowValue
+	}
+	return overflow
+}
+
+// Delete removes the series with the given labels and frees its slot for a
+// new label set.
+func (v *Vec[T]) Delete(labels prometheus.Labels) bool {
+	lvs := make([]string, 0, len(v.labelNames))
+	for _, name := range v.labelNames {
+		lvs = append(lvs, labels[name])
+	}
+	v.mu.Lock()
+	delete(v.seen, strings.Join(lvs, "\xff"))
+	v.mu.Unlock()
+	return v.vec.Delete(labels)
+}
+
+func (v *Vec[T]) Describe(ch chan<- *prometheus.Desc) {
+	v.vec.Describe(ch)
+	v.overflow.Describe(ch)
+}
+
+func (v *Vec[T]) Collect(ch chan<- prometheus.Metric) {
+	v.vec.Collect(ch)
+	v.overflow.Collect(ch)
+}
@@ -0,0 +1,67 @@
+package limit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCounterVecOverflow(t *testing.T) {
+	v := NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "h"}, []string{"path"}, 2)
+
+	v.WithLabelValues("/a").Inc()
+	v.With(prometheus.Labels{"path": "/b"}).Inc()
+	// 超出上限的组合进入 overflow 序列，同一组合多次更新只计一次
+	v.WithLabelValues("/c").Inc()
+	v.WithLabelValues("/c").Inc()
+	v.WithLabelValues("/d").Inc()
+	v.WithLabelValues("/a").Inc()
+
+	if got := testutil.ToFloat64(v.vec.WithLabelValues("/a")); got != 2 {
+		t.Errorf("/a = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(v.vec.WithLabelValues(OverflowValue)); got != 3 {
+		t.Errorf("overflow series = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(v.overflow); got != 2 {
+		t.Errorf("cardinality_overflow_total = %v, want 2 distinct label sets", got)
+	}
+
+	// 删除后空出的位置可以给新的组合
+	v.Delete(prometheus.Labels{"path": "/b"})
+	v.WithLabelValues("/e").Inc()
+	if got := testutil.ToFloat64(v.vec.WithLabelValues("/e")); got != 1 {
+		t.Errorf("/e = %v, want 1 after a slot was freed", got)
+	}
+	if got := testutil.CollectAndCount(v, "requests_total"); got != 3 {
+		t.Errorf("got %d series, want /a, /e and the overflow series", got)
+	}
+}
+
+func TestOverflowMetricLabel(t *testing.T) {
+	v := NewHistogramVec(prometheus.HistogramOpts{Namespace: "app", Subsystem: "http", Name: "latency_seconds", Help: "h"}, []string{"path"}, 1)
+	v.WithLabelValues("/a").Observe(1)
+	v.WithLabelValues("/b").Observe(1)
+
+	// metric 标签为完整的指标名，与 namespace 拼接后的名称一致
+	want := `
+# HELP cardinality_overflow_total Distinct label sets that exceeded the cardinality limit and went to the overflow series.
+# TYPE cardinality_overflow_total counter
+cardinality_overflow_total{metric="app_http_latency_seconds"} 1
+`
+	if err := testutil.CollectAndCompare(v, strings.NewReader(want), "cardinality_overflow_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithLabelCountMismatchPanics(t *testing.T) {
+	v := NewGaugeVec(prometheus.GaugeOpts{Name: "g", Help: "h"}, []string{"a", "b"}, 1)
+	defer func() {
+		if recover() == nil {
+			t.Error("With() with a missing label did not panic")
+		}
+	}()
+	v.With(prometheus.Labels{"a": "x"})
+}
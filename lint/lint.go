@@ -0,0 +1,267 @@
+// Package lint checks metric names against the Prometheus naming
+// conventions when collectors are registered and when their metrics are
+// first gathered.
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil/promlint"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// Mode 决定发现问题时的处理方式
+type Mode string
+
+const (
+	Off    Mode = "off"
+	Warn   Mode = "warn"   // 记录日志并导出 metric_lint_violations，仍然注册和导出
+	Strict Mode = "strict" // 拒绝注册，采集时发现的问题指标不再导出
+)
+
+// Validations 在 promlint 默认规则之外追加的检查
+var Validations = []promlint.Validation{LintLowercase, LintHistogramUnit}
+
+// LintLowercase detects metric names with uppercase letters, e.g. QPS_statistic.
+func LintLowercase(mf *dto.MetricFamily) []error {
+	if mf.GetName() != strings.ToLower(mf.GetName()) {
+		return []error{errors.New("metric names should be lowercase 'snake_case'")}
+	}
+	return nil
+}
+
+// baseUnits 为直方图和摘要常用的基本单位后缀
+var baseUnits = []string{"_seconds", "_bytes", "_ratio", "_meters", "_volts", "_amperes", "_joules", "_grams", "_celsius"}
+
+// LintHistogramUnit detects histograms and summaries whose name carries no
+// base unit, such as a latency in milliseconds named lantency_statistic.
+func LintHistogramUnit(mf *dto.MetricFamily) []error {
+	if mf.GetType() != dto.MetricType_HISTOGRAM && mf.GetType() != dto.MetricType_SUMMARY {
+		return nil
+	}
+	for _, unit := range baseUnits {
+		if strings.HasSuffix(mf.GetName(), unit) {
+			return nil
+		}
+	}
+	return []error{errors.New("histogram and summary names should end with a base unit like _seconds or _bytes")}
+}
+
+// Registerer 在注册时按 Desc 检查指标名和帮助文本，Gatherer 在指标第一次
+// 被采集时补充依赖类型的检查
+type Registerer struct {
+	prometheus.Registerer
+	mode   Mode
+	logger *slog.Logger
+
+	violations *prometheus.GaugeVec
+
+	mu       sync.Mutex
+	reported map[promlint.Problem]struct{}
+	checked  map[string]struct{} // 已在采集结果中检查过的指标名
+	rejected map[string]string   // strict 模式下不导出的指标名及其问题
+}
+
+// NewRegisterer wraps reg. The returned Registerer is also a Collector of
+// metric_lint_violations for the problems it found in warn mode.
+func NewRegisterer(reg prometheus.Registerer, mode Mode, logger *slog.Logger) *Registerer {
+	return &Registerer{
+		Registerer: reg,
+		mode:       mode,
+		logger:     logger,
+		violations: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "metric_lint_violations",
+			Help: "Naming convention problems found in exported metrics.",
+		}, []string{"metric", "problem"}),
+		reported: make(map[promlint.Problem]struct{}),
+		checked:  make(map[string]struct{}),
+		rejected: make(map[string]string),
+	}
+}
+
+// Register lints the Descs of c before passing it on. c is not collected. In
+// strict mode a collector with problems is not registered.
+func (r *Registerer) Register(c prometheus.Collector) error {
+	if r.mode == Off || r.mode == "" {
+		return r.Registerer.Register(c)
+	}
+	problems, err := Lint(c)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 && r.mode == Strict {
+		return fmt.Errorf("metric lint failed: %s", joinProblems(problems))
+	}
+	if err := r.Registerer.Register(c); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.report(problems)
+	r.mu.Unlock()
+	return nil
+}
+
+// MustRegister 需要覆盖，否则会绕过检查直接调用内层 Registerer
+func (r *Registerer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *Registerer) Describe(ch chan<- *prometheus.Desc) { r.violations.Describe(ch) }
+func (r *Registerer) Collect(ch chan<- prometheus.Metric) { r.violations.Collect(ch) }
+
+// Gatherer returns a Gatherer that lints every metric family of g the first
+// time it is gathered, which covers the checks that need the metric type.
+// In strict mode families with problems are left out of every later result
+// and Gather returns an error naming them.
+func (r *Registerer) Gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	if r.mode == Off || r.mode == "" {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		var unchecked []*dto.MetricFamily
+		r.mu.Lock()
+		for _, mf := range mfs {
+			if _, ok := r.checked[mf.GetName()]; !ok {
+				r.checked[mf.GetName()] = struct{}{}
+				unchecked = append(unchecked, mf)
+			}
+		}
+		if len(unchecked) > 0 {
+			problems, lintErr := lintFamilies(unchecked)
+			if lintErr != nil {
+				r.logger.Error("Error linting metrics", "err", lintErr)
+			}
+			if r.mode == Strict {
+				for _, p := range problems {
+					r.rejected[p.Metric] = joinProblems(filterProblems(problems, p.Metric))
+				}
+			}
+			r.report(problems)
+		}
+		var errs []error
+		if len(r.rejected) > 0 {
+			mfs = slices.DeleteFunc(mfs, func(mf *dto.MetricFamily) bool {
+				text, ok := r.rejected[mf.GetName()]
+				if ok {
+					errs = append(errs, fmt.Errorf("metric lint failed: %s", text))
+				}
+				return ok
+			})
+		}
+		r.mu.Unlock()
+		return mfs, errors.Join(append([]error{err}, errs...)...)
+	})
+}
+
+// report 每个问题只记录一次，调用时需持有 mu
+func (r *Registerer) report(problems []promlint.Problem) {
+	for _, p := range problems {
+		if _, ok := r.reported[p]; ok {
+			continue
+		}
+		r.reported[p] = struct{}{}
+		if r.mode == Strict {
+			r.logger.Error("Metric does not follow naming conventions, dropping it", "metric", p.Metric, "problem", p.Text)
+			continue
+		}
+		r.logger.Warn("Metric does not follow naming conventions", "metric", p.Metric, "problem", p.Text)
+		r.violations.WithLabelValues(p.Metric, p.Text).Set(1)
+	}
+}
+
+func filterProblems(problems []promlint.Problem, metric string) []promlint.Problem {
+	var out []promlint.Problem
+	for _, p := range problems {
+		if p.Metric == metric {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func joinProblems(problems []promlint.Problem) string {
+	texts := make([]string, 0, len(problems))
+	for _, p := range problems {
+		texts = append(texts, p.Metric+": "+p.Text)
+	}
+	return strings.Join(texts, "; ")
+}
+
+// Lint checks the Descs of c with promlint and Validations without collecting
+// c. A Desc carries no metric type, so only the rules that apply to untyped
+// metrics, i.e. those on the name and help text, are checked.
+func Lint(c prometheus.Collector) ([]promlint.Problem, error) {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(descs)
+		close(descs)
+	}()
+	var mfs []*dto.MetricFamily
+	seen := make(map[string]struct{})
+	for d := range descs {
+		name, help, ok := DescName(d)
+		// 名称无效的 Desc 交给真正的注册报错
+		if !ok || !model.IsValidMetricName(model.LabelValue(name)) {
+			continue
+		}
+		if _, dup := seen[name]; dup {
+			continue
+		}
+		seen[name] = struct{}{}
+		mf := &dto.MetricFamily{Name: &name, Type: dto.MetricType_UNTYPED.Enum()}
+		// promlint 只把缺失的 help 当作问题
+		if help != "" {
+			mf.Help = &help
+		}
+		mfs = append(mfs, mf)
+	}
+	return lintFamilies(mfs)
+}
+
+func lintFamilies(mfs []*dto.MetricFamily) ([]promlint.Problem, error) {
+	l := promlint.NewWithMetricFamilies(mfs)
+	l.AddCustomValidations(Validations...)
+	return l.Lint()
+}
+
+// DescName returns the fully qualified name and the help text of d, which
+// Desc does not export, by parsing d.String(). ok is false if the format is
+// not recognized.
+func DescName(d *prometheus.Desc) (fqName, help string, ok bool) {
+	rest, ok := strings.CutPrefix(d.String(), "Desc{fqName: ")
+	if !ok {
+		return "", "", false
+	}
+	fqName, rest, ok = cutQuoted(rest)
+	if !ok {
+		return "", "", false
+	}
+	if rest, ok = strings.CutPrefix(rest, ", help: "); !ok {
+		return "", "", false
+	}
+	help, _, ok = cutQuoted(rest)
+	return fqName, help, ok
+}
+
+// cutQuoted 解析 s 开头由 %q 输出的字符串
+func cutQuoted(s string) (value, rest string, ok bool) {
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", false
+	}
+	value, err = strconv.Unquote(quoted)
+	return value, s[len(quoted):], err == nil
+}
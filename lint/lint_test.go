@@ -0,0 +1,155 @@
+package lint
+
+import (
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// panicCollector 在 Collect 时 panic，用来确认注册时不会采集
+type panicCollector struct {
+	descs []*prometheus.Desc
+}
+
+func (c panicCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+func (c panicCollector) Collect(chan<- prometheus.Metric) {
+	panic("collected at registration")
+}
+
+func newTestRegisterer(mode Mode) (*prometheus.Registry, *Registerer) {
+	reg := prometheus.NewRegistry()
+	return reg, NewRegisterer(reg, mode, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestLintDescs(t *testing.T) {
+	// 可变标签数不影响检查
+	many := make([]string, 100)
+	for i := range many {
+		many[i] = "l" + strconv.Itoa(i)
+	}
+	c := panicCollector{descs: []*prometheus.Desc{
+		prometheus.NewDesc("many_labels_Total", "Upper case.", many, nil),
+		// 名称无效的 Desc 留给注册报错
+		prometheus.NewDesc("1invalid", "Invalid name.", nil, nil),
+		prometheus.NewDesc("good_seconds", "Fine.", []string{"a", "b"}, prometheus.Labels{"c": "d"}),
+		prometheus.NewDesc("QPS_statistic", "Upper case.", nil, nil),
+		prometheus.NewDesc("no_help", "", []string{"a"}, nil),
+		prometheus.NewDesc("request_milliseconds", "Not a base unit.", nil, nil),
+	}}
+	problems, err := Lint(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]string)
+	for _, p := range problems {
+		got[p.Metric] = append(got[p.Metric], p.Text)
+	}
+	if len(got["good_seconds"]) != 0 {
+		t.Errorf("good_seconds: unexpected problems %q", got["good_seconds"])
+	}
+	if _, ok := got["1invalid"]; ok {
+		t.Errorf("1invalid: unexpected problems %q", got["1invalid"])
+	}
+	for _, name := range []string{"many_labels_Total", "QPS_statistic", "no_help", "request_milliseconds"} {
+		if len(got[name]) == 0 {
+			t.Errorf("%s: no problems found", name)
+		}
+	}
+}
+
+func TestRegisterStrict(t *testing.T) {
+	_, r := newTestRegisterer(Strict)
+	err := r.Register(panicCollector{descs: []*prometheus.Desc{prometheus.NewDesc("QPS_statistic", "Upper case.", nil, nil)}})
+	if err == nil || !strings.Contains(err.Error(), "QPS_statistic") {
+		t.Fatalf("Register() = %v, want lint error", err)
+	}
+	if err := r.Register(panicCollector{descs: []*prometheus.Desc{prometheus.NewDesc("good_seconds", "Fine.", nil, nil)}}); err != nil {
+		t.Fatalf("Register() = %v, want nil", err)
+	}
+}
+
+func TestRegisterWarn(t *testing.T) {
+	reg, r := newTestRegisterer(Warn)
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "QPS_statistic", Help: "Upper case."})
+	if err := r.Register(g); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(r); n != 1 {
+		t.Fatalf("violations = %d, want 1", n)
+	}
+	if n, err := testutil.GatherAndCount(reg, "QPS_statistic"); err != nil || n != 1 {
+		t.Fatalf("QPS_statistic series = %d, %v; want 1", n, err)
+	}
+}
+
+func TestGathererTypeChecks(t *testing.T) {
+	for _, mode := range []Mode{Warn, Strict} {
+		t.Run(string(mode), func(t *testing.T) {
+			reg, r := newTestRegisterer(mode)
+			// 计数器缺少 _total 只有知道类型后才能发现，注册时不报错
+			counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "requests", Help: "Requests."})
+			latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Help: "Latency."})
+			r.MustRegister(counter, latency)
+
+			g := r.Gatherer(reg)
+			for i := 0; i < 2; i++ {
+				mfs, err := g.Gather()
+				var names []string
+				for _, mf := range mfs {
+					names = append(names, mf.GetName())
+				}
+				switch mode {
+				case Warn:
+					if err != nil || len(names) != 2 {
+						t.Fatalf("Gather() = %v, %v; want both families", names, err)
+					}
+				case Strict:
+					if err == nil || len(names) != 1 || names[0] != "latency_seconds" {
+						t.Fatalf("Gather() = %v, %v; want only latency_seconds and an error", names, err)
+					}
+				}
+			}
+			want := 0
+			if mode == Warn {
+				want = 1
+			}
+			if n := testutil.CollectAndCount(r); n != want {
+				t.Errorf("violations = %d, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestGathererOff(t *testing.T) {
+	reg, r := newTestRegisterer(Off)
+	if g := r.Gatherer(reg); g != prometheus.Gatherer(reg) {
+		t.Errorf("Gatherer() in off mode should return the wrapped Gatherer")
+	}
+}
+
+func TestDescName(t *testing.T) {
+	for _, d := range []struct {
+		desc       *prometheus.Desc
+		name, help string
+	}{
+		{prometheus.NewDesc("a_total", "Plain help.", nil, nil), "a_total", "Plain help."},
+		// 帮助文本中的引号、逗号和换行不影响解析
+		{prometheus.NewDesc("b", `Help with "quotes", help: and`+"\n", []string{"x"}, prometheus.Labels{"c": `"v"`}), "b", `Help with "quotes", help: and` + "\n"},
+		{prometheus.NewDesc("c", "", nil, nil), "c", ""},
+	} {
+		name, help, ok := DescName(d.desc)
+		if !ok || name != d.name || help != d.help {
+			t.Errorf("DescName(%s) = %q, %q, %v", d.desc, name, help, ok)
+		}
+	}
+}
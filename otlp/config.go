@@ -0,0 +1,57 @@
+// Package otlp translates gathered metric families into OpenTelemetry
+// metrics and pushes them to an OTLP/HTTP endpoint.
+package otlp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Config 为 OTLP 导出配置，endpoint 为空时不导出
+type Config struct {
+	Endpoint           string            `yaml:"endpoint"` // 完整地址，如 http://otel-collector:4318/v1/metrics
+	Interval           model.Duration    `yaml:"interval"`
+	Timeout            model.Duration    `yaml:"timeout"`
+	Compression        string            `yaml:"compression"` // gzip 或 none
+	Headers            map[string]string `yaml:"headers,omitempty"`
+	ResourceAttributes map[string]string `yaml:"resource_attributes,omitempty"` // 未设置 service.name 时使用 exporter
+	MaxRetries         int               `yaml:"max_retries"`
+}
+
+// DefaultConfig 与 OpenTelemetry SDK 的默认导出间隔和超时相同
+var DefaultConfig = Config{
+	Interval:    model.Duration(60 * time.Second),
+	Timeout:     model.Duration(10 * time.Second),
+	Compression: "gzip",
+	MaxRetries:  3,
+}
+
+// Enabled reports whether an OTLP endpoint is configured.
+func (c *Config) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+// Validate checks the settings that the YAML decoder cannot.
+func (c *Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid endpoint %q", c.Endpoint)
+	}
+	if c.Interval <= 0 || c.Timeout <= 0 {
+		return errors.New("interval and timeout must be positive")
+	}
+	if c.Compression != "gzip" && c.Compression != "none" {
+		return fmt.Errorf("invalid compression %q, want gzip or none", c.Compression)
+	}
+	if c.MaxRetries < 0 {
+		return errors.New("max_retries must not be negative")
+	}
+	return nil
+}
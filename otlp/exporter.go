@@ -0,0 +1,194 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+)
+
+// scopeName 为 OTLP InstrumentationScope 和默认的 service.name
+const scopeName = "exporter"
+
+// Exporter 定期采集并以 OTLP/HTTP protobuf 推送，跨配置重载保留。
+// 每次导出的都是累计值，失败的导出在重试用尽后直接丢弃，下一次导出会带上最新值，因此不需要队列。
+type Exporter struct {
+	logger *slog.Logger
+	client *http.Client
+
+	mu  sync.Mutex
+	cfg Config
+
+	exports  prometheus.Counter
+	failures prometheus.Counter
+	points   prometheus.Counter
+}
+
+func NewExporter(logger *slog.Logger) *Exporter {
+	return &Exporter{
+		logger: logger,
+		client: &http.Client{},
+		cfg:    DefaultConfig,
+		exports: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_otlp_exports_total",
+			Help: "OTLP export requests attempted, not counting retries.",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_otlp_export_failures_total",
+			Help: "OTLP export requests that failed after all retries.",
+		}),
+		points: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_otlp_data_points_total",
+			Help: "Data points successfully exported over OTLP.",
+		}),
+	}
+}
+
+// SetConfig applies cfg; it takes effect with the next export.
+func (e *Exporter) SetConfig(cfg Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cfg = cfg
+}
+
+func (e *Exporter) config() Config {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cfg
+}
+
+// Run exports g every interval until ctx is done. Cumulative metrics
+// without a created timestamp use the time Run was called as their start
+// time, as the registry is rebuilt on every reload.
+func (e *Exporter) Run(ctx context.Context, g prometheus.Gatherer) {
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(e.config().Interval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := e.export(ctx, g, start); err != nil && ctx.Err() == nil {
+			e.failures.Inc()
+			e.logger.Error("Error exporting metrics over OTLP", "err", err)
+		}
+	}
+}
+
+func (e *Exporter) export(ctx context.Context, g prometheus.Gatherer, start time.Time) error {
+	// Gather 出错时仍会返回其余指标，照常导出
+	mfs, _ := g.Gather()
+	now := time.Now()
+	var metrics [][]byte
+	var points int
+	for _, mf := range mfs {
+		m, n := translateFamily(mf, now, start)
+		if n > 0 {
+			metrics = append(metrics, m)
+			points += n
+		}
+	}
+
+	cfg := e.config()
+	resource := maps.Clone(cfg.ResourceAttributes)
+	if resource == nil {
+		resource = map[string]string{}
+	}
+	if _, ok := resource["service.name"]; !ok {
+		resource["service.name"] = scopeName
+	}
+	body := encodeRequest(resource, scopeName, version.Version, metrics)
+	if cfg.Compression == "gzip" {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	e.exports.Inc()
+	backoff := min(time.Second, time.Duration(cfg.Interval))
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := e.post(ctx, cfg, body)
+		if err == nil {
+			e.points.Add(float64(points))
+			return nil
+		}
+		if retryAfter < 0 || attempt >= cfg.MaxRetries {
+			return err
+		}
+		wait := max(backoff, retryAfter)
+		e.logger.Warn("Error exporting metrics over OTLP, retrying", "attempt", attempt+1, "backoff", wait.String(), "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, time.Duration(cfg.Interval))
+	}
+}
+
+// post 发送一次请求。可重试时 retryAfter 不小于 0（服务端给出的 Retry-After，未给出为 0），
+// 按 OTLP/HTTP 规范只重试网络错误和 429、502、503、504。
+func (e *Exporter) post(ctx context.Context, cfg Config, body []byte) (retryAfter time.Duration, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "exporter/"+version.Version)
+	if cfg.Compression == "gzip" {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return 0, nil
+	}
+	// 错误响应体为 protobuf 编码的 Status，这里只截取一段用于日志
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	err = fmt.Errorf("server returned HTTP status %s: %q", resp.Status, strings.TrimSpace(string(msg)))
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(max(secs, 0)) * time.Second, err
+	}
+	return -1, err
+}
+
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.exports.Describe(ch)
+	e.failures.Describe(ch)
+	e.points.Describe(ch)
+}
+
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.exports.Collect(ch)
+	e.failures.Collect(ch)
+	e.points.Collect(ch)
+}
@@ -0,0 +1,439 @@
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// requestDesc 为 opentelemetry-proto metrics/v1 中用到的消息定义，字段号与上游一致。
+// 测试用 dynamicpb 按这份定义独立解码，而不是复用 proto.go 的编码逻辑
+var requestDesc = func() protoreflect.MessageDescriptor {
+	type typ = descriptorpb.FieldDescriptorProto_Type
+	const (
+		msg     = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+		str     = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		fixed64 = descriptorpb.FieldDescriptorProto_TYPE_FIXED64
+		double  = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+		sint32  = descriptorpb.FieldDescriptorProto_TYPE_SINT32
+		uint64_ = descriptorpb.FieldDescriptorProto_TYPE_UINT64
+		boolean = descriptorpb.FieldDescriptorProto_TYPE_BOOL
+		enum    = descriptorpb.FieldDescriptorProto_TYPE_ENUM
+	)
+	field := func(name string, number int32, t typ, repeated bool, typeName string) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: t.Enum(), Label: label.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(".otlp." + typeName)
+		}
+		return f
+	}
+	message := func(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+	}
+	temporality := func(name string, number int32) *descriptorpb.EnumValueDescriptorProto {
+		return &descriptorpb.EnumValueDescriptorProto{Name: proto.String(name), Number: proto.Int32(number)}
+	}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("otlp/metrics.proto"),
+		Package: proto.String("otlp"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("AggregationTemporality"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				temporality("AGGREGATION_TEMPORALITY_UNSPECIFIED", 0),
+				temporality("AGGREGATION_TEMPORALITY_DELTA", 1),
+				temporality("AGGREGATION_TEMPORALITY_CUMULATIVE", 2),
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			message("ExportMetricsServiceRequest", field("resource_metrics", 1, msg, true, "ResourceMetrics")),
+			message("ResourceMetrics",
+				field("resource", 1, msg, false, "Resource"),
+				field("scope_metrics", 2, msg, true, "ScopeMetrics")),
+			message("Resource", field("attributes", 1, msg, true, "KeyValue")),
+			message("KeyValue", field("key", 1, str, false, ""), field("value", 2, msg, false, "AnyValue")),
+			message("AnyValue", field("string_value", 1, str, false, "")),
+			message("ScopeMetrics",
+				field("scope", 1, msg, false, "InstrumentationScope"),
+				field("metrics", 2, msg, true, "Metric")),
+			message("InstrumentationScope", field("name", 1, str, false, ""), field("version", 2, str, false, "")),
+			message("Metric",
+				field("name", 1, str, false, ""),
+				field("description", 2, str, false, ""),
+				field("gauge", 5, msg, false, "Gauge"),
+				field("sum", 7, msg, false, "Sum"),
+				field("histogram", 9, msg, false, "Histogram"),
+				field("exponential_histogram", 10, msg, false, "ExponentialHistogram"),
+				field("summary", 11, msg, false, "Summary")),
+			message("Gauge", field("data_points", 1, msg, true, "NumberDataPoint")),
+			message("Sum",
+				field("data_points", 1, msg, true, "NumberDataPoint"),
+				field("aggregation_temporality", 2, enum, false, "AggregationTemporality"),
+				field("is_monotonic", 3, boolean, false, "")),
+			message("Histogram",
+				field("data_points", 1, msg, true, "HistogramDataPoint"),
+				field("aggregation_temporality", 2, enum, false, "AggregationTemporality")),
+			message("ExponentialHistogram",
+				field("data_points", 1, msg, true, "ExponentialHistogramDataPoint"),
+				field("aggregation_temporality", 2, enum, false, "AggregationTemporality")),
+			message("Summary", field("data_points", 1, msg, true, "SummaryDataPoint")),
+			message("NumberDataPoint",
+				field("attributes", 7, msg, true, "KeyValue"),
+				field("start_time_unix_nano", 2, fixed64, false, ""),
+				field("time_unix_nano", 3, fixed64, false, ""),
+				field("as_double", 4, double, false, "")),
+			message("HistogramDataPoint",
+				field("attributes", 9, msg, true, "KeyValue"),
+				field("start_time_unix_nano", 2, fixed64, false, ""),
+				field("time_unix_nano", 3, fixed64, false, ""),
+				field("count", 4, fixed64, false, ""),
+				field("sum", 5, double, false, ""),
+				field("bucket_counts", 6, fixed64, true, ""),
+				field("explicit_bounds", 7, double, true, "")),
+			message("ExponentialHistogramDataPoint",
+				field("attributes", 1, msg, true, "KeyValue"),
+				field("start_time_unix_nano", 2, fixed64, false, ""),
+				field("time_unix_nano", 3, fixed64, false, ""),
+				field("count", 4, fixed64, false, ""),
+				field("sum", 5, double, false, ""),
+				field("scale", 6, sint32, false, ""),
+				field("zero_count", 7, fixed64, false, ""),
+				field("positive", 8, msg, false, "Buckets"),
+				field("negative", 9, msg, false, "Buckets"),
+				field("zero_threshold", 14, double, false, "")),
+			message("Buckets", field("offset", 1, sint32, false, ""), field("bucket_counts", 2, uint64_, true, "")),
+			message("SummaryDataPoint",
+				field("attributes", 7, msg, true, "KeyValue"),
+				field("start_time_unix_nano", 2, fixed64, false, ""),
+				field("time_unix_nano", 3, fixed64, false, ""),
+				field("count", 4, fixed64, false, ""),
+				field("sum", 5, double, false, ""),
+				field("quantile_values", 6, msg, true, "ValueAtQuantile")),
+			message("ValueAtQuantile", field("quantile", 1, double, false, ""), field("value", 2, double, false, "")),
+		},
+	}, nil)
+	if err != nil {
+		panic(err)
+	}
+	return fd.Messages().ByName("ExportMetricsServiceRequest")
+}()
+
+// decodeRequest 解码请求体并转为 protojson 的通用表示，便于与期望的 JSON 比较
+func decodeRequest(body []byte) (map[string]any, error) {
+	req := dynamicpb.NewMessage(requestDesc)
+	if err := proto.Unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	js, err := protojson.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]any
+	return out, json.Unmarshal(js, &out)
+}
+
+// receiver 解码收到的请求，status 依次决定每个请求的响应码，用完后返回 200
+type receiver struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	status   []int
+	requests []map[string]any // 成功接收的请求
+	attempts int
+	encoding string // 最后一个请求的 Content-Encoding
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if got := r.Header.Get("Content-Type"); got != "application/x-protobuf" {
+		rc.t.Errorf("Content-Type = %q", got)
+	}
+	if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+		rc.t.Errorf("Authorization = %q", got)
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			rc.t.Errorf("decompressing request: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	raw, _ := io.ReadAll(body)
+	req, err := decodeRequest(raw)
+	if err != nil {
+		rc.t.Errorf("decoding request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.attempts++
+	rc.encoding = r.Header.Get("Content-Encoding")
+	code := http.StatusOK
+	if len(rc.status) > 0 {
+		code, rc.status = rc.status[0], rc.status[1:]
+	}
+	if code/100 == 2 {
+		rc.requests = append(rc.requests, req)
+	}
+	w.WriteHeader(code)
+}
+
+func (rc *receiver) received() (attempts int, requests []map[string]any) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.attempts, rc.requests
+}
+
+func newTestExporter(endpoint, compression string) *Exporter {
+	e := NewExporter(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	cfg := DefaultConfig
+	cfg.Endpoint = endpoint
+	cfg.Compression = compression
+	cfg.Interval = model.Duration(time.Millisecond)
+	cfg.Headers = map[string]string{"Authorization": "Bearer secret"}
+	e.SetConfig(cfg)
+	return e
+}
+
+func family(name string, typ dto.MetricType, metrics ...*dto.Metric) *dto.MetricFamily {
+	for _, m := range metrics {
+		m.TimestampMs = proto.Int64(2000)
+	}
+	return &dto.MetricFamily{Name: proto.String(name), Help: proto.String(name + " help."), Type: typ.Enum(), Metric: metrics}
+}
+
+// metrics 取出唯一的 resource 和 scope 下的 Metric，按名称索引
+func metrics(t *testing.T, req map[string]any) map[string]any {
+	t.Helper()
+	rm := req["resourceMetrics"].([]any)
+	if len(rm) != 1 {
+		t.Fatalf("got %d resource metrics, want 1", len(rm))
+	}
+	sm := rm[0].(map[string]any)["scopeMetrics"].([]any)
+	if len(sm) != 1 {
+		t.Fatalf("got %d scope metrics, want 1", len(sm))
+	}
+	out := make(map[string]any)
+	for _, m := range sm[0].(map[string]any)["metrics"].([]any) {
+		out[m.(map[string]any)["name"].(string)] = m
+	}
+	return out
+}
+
+func TestExportTranslation(t *testing.T) {
+	rc := &receiver{t: t}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	e := newTestExporter(srv.URL, "none")
+	cfg := e.config()
+	cfg.ResourceAttributes = map[string]string{"host.name": "h1"}
+	e.SetConfig(cfg)
+
+	g := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return []*dto.MetricFamily{
+			family("temperature", dto.MetricType_GAUGE, &dto.Metric{
+				Label: []*dto.LabelPair{{Name: proto.String("room"), Value: proto.String("a")}},
+				Gauge: &dto.Gauge{Value: proto.Float64(21.5)},
+			}),
+			family("requests_total", dto.MetricType_COUNTER,
+				&dto.Metric{Counter: &dto.Counter{Value: proto.Float64(3)}},
+				&dto.Metric{
+					Label:   []*dto.LabelPair{{Name: proto.String("code"), Value: proto.String("500")}},
+					Counter: &dto.Counter{Value: proto.Float64(1), CreatedTimestamp: timestamppb.New(time.UnixMilli(200))},
+				},
+			),
+			family("latency_seconds", dto.MetricType_HISTOGRAM, &dto.Metric{Histogram: &dto.Histogram{
+				SampleCount: proto.Uint64(4),
+				SampleSum:   proto.Float64(5),
+				Bucket: []*dto.Bucket{
+					{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(1)},
+					{UpperBound: proto.Float64(2), CumulativeCount: proto.Uint64(3)},
+				},
+			}}),
+			// 正桶 span 之间空一个桶，偏移量在 OTLP 中减一
+			family("native_seconds", dto.MetricType_HISTOGRAM, &dto.Metric{Histogram: &dto.Histogram{
+				SampleCount:   proto.Uint64(9),
+				SampleSum:     proto.Float64(10),
+				Schema:        proto.Int32(1),
+				ZeroThreshold: proto.Float64(0.001),
+				ZeroCount:     proto.Uint64(1),
+				PositiveSpan:  []*dto.BucketSpan{{Offset: proto.Int32(2), Length: proto.Uint32(2)}, {Offset: proto.Int32(1), Length: proto.Uint32(1)}},
+				PositiveDelta: []int64{2, -1, 3},
+				NegativeSpan:  []*dto.BucketSpan{{Offset: proto.Int32(-1), Length: proto.Uint32(1)}},
+				NegativeDelta: []int64{1},
+			}}),
+			family("queue_seconds", dto.MetricType_SUMMARY, &dto.Metric{Summary: &dto.Summary{
+				SampleCount: proto.Uint64(2),
+				SampleSum:   proto.Float64(3),
+				Quantile:    []*dto.Quantile{{Quantile: proto.Float64(0.5), Value: proto.Float64(1)}, {Quantile: proto.Float64(0.9), Value: proto.Float64(2)}},
+			}}),
+			family("inflight", dto.MetricType_GAUGE_HISTOGRAM, &dto.Metric{Histogram: &dto.Histogram{
+				SampleCount: proto.Uint64(1),
+				Bucket:      []*dto.Bucket{{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(1)}},
+			}}),
+		}, nil
+	})
+	if err := e.export(context.Background(), g, time.UnixMilli(100)); err != nil {
+		t.Fatal(err)
+	}
+	_, requests := rc.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+
+	var resource map[string]any
+	mustUnmarshal(t, `{"attributes": [
+		{"key": "host.name", "value": {"stringValue": "h1"}},
+		{"key": "service.name", "value": {"stringValue": "exporter"}}
+	]}`, &resource)
+	if got := requests[0]["resourceMetrics"].([]any)[0].(map[string]any)["resource"]; !reflect.DeepEqual(got, resource) {
+		t.Errorf("resource = %v, want %v", got, resource)
+	}
+
+	// 没有 created timestamp 的累计值以 start（100ms）为起始时间
+	want := map[string]string{
+		"temperature": `{"name": "temperature", "description": "temperature help.", "gauge": {"dataPoints": [
+			{"attributes": [{"key": "room", "value": {"stringValue": "a"}}], "timeUnixNano": "2000000000", "asDouble": 21.5}
+		]}}`,
+		"requests_total": `{"name": "requests_total", "description": "requests_total help.", "sum": {
+			"aggregationTemporality": "AGGREGATION_TEMPORALITY_CUMULATIVE", "isMonotonic": true, "dataPoints": [
+				{"startTimeUnixNano": "100000000", "timeUnixNano": "2000000000", "asDouble": 3},
+				{"attributes": [{"key": "code", "value": {"stringValue": "500"}}],
+				 "startTimeUnixNano": "200000000", "timeUnixNano": "2000000000", "asDouble": 1}
+		]}}`,
+		"latency_seconds": `{"name": "latency_seconds", "description": "latency_seconds help.", "histogram": {
+			"aggregationTemporality": "AGGREGATION_TEMPORALITY_CUMULATIVE", "dataPoints": [
+				{"startTimeUnixNano": "100000000", "timeUnixNano": "2000000000", "count": "4", "sum": 5,
+				 "bucketCounts": ["1", "2", "1"], "explicitBounds": [1, 2]}
+		]}}`,
+		"native_seconds": `{"name": "native_seconds", "description": "native_seconds help.", "exponentialHistogram": {
+			"aggregationTemporality": "AGGREGATION_TEMPORALITY_CUMULATIVE", "dataPoints": [
+				{"startTimeUnixNano": "100000000", "timeUnixNano": "2000000000", "count": "9", "sum": 10,
+				 "scale": 1, "zeroCount": "1", "zeroThreshold": 0.001,
+				 "positive": {"offset": 1, "bucketCounts": ["2", "1", "0", "4"]},
+				 "negative": {"offset": -2, "bucketCounts": ["1"]}}
+		]}}`,
+		"queue_seconds": `{"name": "queue_seconds", "description": "queue_seconds help.", "summary": {"dataPoints": [
+			{"startTimeUnixNano": "100000000", "timeUnixNano": "2000000000", "count": "2", "sum": 3,
+			 "quantileValues": [{"quantile": 0.5, "value": 1}, {"quantile": 0.9, "value": 2}]}
+		]}}`,
+	}
+	got := metrics(t, requests[0])
+	for name, js := range want {
+		var w any
+		mustUnmarshal(t, js, &w)
+		if !reflect.DeepEqual(got[name], w) {
+			g, _ := json.Marshal(got[name])
+			t.Errorf("%s:\ngot  %s\nwant %s", name, g, js)
+		}
+	}
+	// gauge histogram 在 OTLP 中没有对应类型，不导出
+	if _, ok := got["inflight"]; ok {
+		t.Error("gauge histogram was exported")
+	}
+	if len(got) != len(want) {
+		t.Errorf("got metrics %v", got)
+	}
+	if got := testutil.ToFloat64(e.points); got != 6 {
+		t.Errorf("data points = %v, want 6", got)
+	}
+}
+
+func mustUnmarshal(t *testing.T, js string, v any) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(js), v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testGatherer() prometheus.Gatherer {
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "c_total", Help: "C."})
+	c.Add(2)
+	reg.MustRegister(c)
+	return reg
+}
+
+func TestExportGzipRetry(t *testing.T) {
+	rc := &receiver{t: t, status: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	e := newTestExporter(srv.URL, "gzip")
+
+	if err := e.export(context.Background(), testGatherer(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	attempts, requests := rc.received()
+	if attempts != 3 || len(requests) != 1 {
+		t.Fatalf("attempts = %d, delivered = %d; want 3 and 1", attempts, len(requests))
+	}
+	if rc.encoding != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", rc.encoding)
+	}
+	if _, ok := metrics(t, requests[0])["c_total"]; !ok {
+		t.Error("c_total missing from the gzip request")
+	}
+	if got := testutil.ToFloat64(e.exports); got != 1 {
+		t.Errorf("exports = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(e.points); got != 1 {
+		t.Errorf("data points = %v, want 1", got)
+	}
+}
+
+func TestExportNoRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status []int
+	}{
+		// 4xx 不重试
+		{"bad request", []int{http.StatusBadRequest}},
+		// 重试用尽
+		{"retries exhausted", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := &receiver{t: t, status: tc.status}
+			srv := httptest.NewServer(rc)
+			defer srv.Close()
+			e := newTestExporter(srv.URL, "none")
+
+			if err := e.export(context.Background(), testGatherer(), time.Now()); err == nil {
+				t.Fatal("expected an error")
+			}
+			if attempts, _ := rc.received(); attempts != len(tc.status) {
+				t.Errorf("attempts = %d, want %d", attempts, len(tc.status))
+			}
+			if got := testutil.ToFloat64(e.points); got != 0 {
+				t.Errorf("data points = %v, want 0", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package otlp
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 以下按 opentelemetry-proto 的 metrics/v1 定义手工编码，只写用到的字段：
+//
+//	ExportMetricsServiceRequest { repeated ResourceMetrics resource_metrics = 1; }
+//	ResourceMetrics { Resource resource = 1; repeated ScopeMetrics scope_metrics = 2; }
+//	Resource        { repeated KeyValue attributes = 1; }
+//	ScopeMetrics    { InstrumentationScope scope = 1; repeated Metric metrics = 2; }
+//	InstrumentationScope { string name = 1; string version = 2; }
+//	KeyValue        { string key = 1; AnyValue value = 2; }
+//	AnyValue        { string string_value = 1; }
+//	Metric          { string name = 1; string description = 2; Gauge gauge = 5; Sum sum = 7;
+//	                  Histogram histogram = 9; ExponentialHistogram exponential_histogram = 10; Summary summary = 11; }
+//
+// 各数据点的字段见 translate.go。
+
+const (
+	// AggregationTemporality
+	temporalityCumulative = 2
+)
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	return appendFixed64(b, num, math.Float64bits(v))
+}
+
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	return appendFixed64(b, num, uint64(t.UnixNano()))
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendSint32(b []byte, num protowire.Number, v int32) []byte {
+	return appendVarint(b, num, protowire.EncodeZigZag(int64(v)))
+}
+
+// appendAttributes 把字符串键值对编码为 repeated KeyValue，按键排序保证输出稳定
+func appendAttributes(b []byte, num protowire.Number, attrs map[string]string) []byte {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var value, kv []byte
+		value = protowire.AppendTag(value, 1, protowire.BytesType)
+		value = protowire.AppendString(value, attrs[k])
+		kv = appendString(kv, 1, k)
+		kv = appendMessage(kv, 2, value)
+		b = appendMessage(b, num, kv)
+	}
+	return b
+}
+
+// encodeRequest 把 metrics（已编码的 Metric 消息）放进单个 resource 和 scope
+func encodeRequest(resource map[string]string, scopeName, scopeVersion string, metrics [][]byte) []byte {
+	var scope, sm, rm []byte
+	scope = appendString(scope, 1, scopeName)
+	scope = appendString(scope, 2, scopeVersion)
+	sm = appendMessage(sm, 1, scope)
+	for _, m := range metrics {
+		sm = appendMessage(sm, 2, m)
+	}
+	rm = appendMessage(rm, 1, appendAttributes(nil, 1, resource))
+	rm = appendMessage(rm, 2, sm)
+	return appendMessage(nil, 1, rm)
+}
@@ -0,0 +1,242 @@
+package otlp
+
+import (
+	"math"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 数据点字段：
+//
+//	Gauge     { repeated NumberDataPoint data_points = 1; }
+//	Sum       { repeated NumberDataPoint data_points = 1; AggregationTemporality aggregation_temporality = 2; bool is_monotonic = 3; }
+//	Histogram / ExponentialHistogram { repeated ... data_points = 1; AggregationTemporality aggregation_temporality = 2; }
+//	Summary   { repeated SummaryDataPoint data_points = 1; }
+//
+//	NumberDataPoint    { attributes = 7; fixed64 start_time_unix_nano = 2; fixed64 time_unix_nano = 3; double as_double = 4; }
+//	HistogramDataPoint { attributes = 9; start = 2; time = 3; fixed64 count = 4; double sum = 5;
+//	                     repeated fixed64 bucket_counts = 6; repeated double explicit_bounds = 7; }
+//	ExponentialHistogramDataPoint { attributes = 1; start = 2; time = 3; fixed64 count = 4; double sum = 5;
+//	                     sint32 scale = 6; fixed64 zero_count = 7; Buckets positive = 8; Buckets negative = 9; double zero_threshold = 14; }
+//	Buckets            { sint32 offset = 1; repeated uint64 bucket_counts = 2; }
+//	SummaryDataPoint   { attributes = 7; start = 2; time = 3; fixed64 count = 4; double sum = 5; repeated ValueAtQuantile quantile_values = 6; }
+//	ValueAtQuantile    { double quantile = 1; double value = 2; }
+
+// translateFamily 把一个 MetricFamily 编码为 OTLP Metric，返回数据点个数。
+// 指标名保持 Prometheus 原样；counter 为单调累计 sum，untyped 按 gauge 处理，
+// 带 schema 的 native histogram 转为 exponential histogram。OTLP 没有对应 gauge histogram 的类型，
+// 这类 family 不导出。累计类型的起始时间优先取 created timestamp，否则为 start。
+func translateFamily(mf *dto.MetricFamily, now, start time.Time) ([]byte, int) {
+	var points [][]byte
+	for _, m := range mf.GetMetric() {
+		ts := now
+		if m.TimestampMs != nil {
+			ts = time.UnixMilli(m.GetTimestampMs())
+		}
+		attrs := make(map[string]string, len(m.GetLabel()))
+		for _, l := range m.GetLabel() {
+			attrs[l.GetName()] = l.GetValue()
+		}
+
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			c := m.GetCounter()
+			points = append(points, numberPoint(attrs, startTime(c.GetCreatedTimestamp().AsTime(), c.CreatedTimestamp != nil, start), ts, c.GetValue()))
+		case dto.MetricType_GAUGE:
+			points = append(points, numberPoint(attrs, time.Time{}, ts, m.GetGauge().GetValue()))
+		case dto.MetricType_UNTYPED:
+			points = append(points, numberPoint(attrs, time.Time{}, ts, m.GetUntyped().GetValue()))
+		case dto.MetricType_SUMMARY:
+			s := m.GetSummary()
+			points = append(points, summaryPoint(attrs, startTime(s.GetCreatedTimestamp().AsTime(), s.CreatedTimestamp != nil, start), ts, s))
+		case dto.MetricType_HISTOGRAM:
+			h := m.GetHistogram()
+			st := startTime(h.GetCreatedTimestamp().AsTime(), h.CreatedTimestamp != nil, start)
+			if isNative(h) {
+				points = append(points, exponentialPoint(attrs, st, ts, h))
+			} else {
+				points = append(points, histogramPoint(attrs, st, ts, h))
+			}
+		}
+	}
+	if len(points) == 0 {
+		return nil, 0
+	}
+
+	var data []byte
+	for _, p := range points {
+		data = appendMessage(data, 1, p)
+	}
+	var field protowire.Number
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		field = 7
+		data = appendVarint(data, 2, temporalityCumulative)
+		data = appendVarint(data, 3, 1)
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		field = 5
+	case dto.MetricType_SUMMARY:
+		field = 11
+	default:
+		// 同一 family 内 native 与经典 histogram 不会混用，以第一个序列为准
+		field = 9
+		if isNative(mf.GetMetric()[0].GetHistogram()) {
+			field = 10
+		}
+		data = appendVarint(data, 2, temporalityCumulative)
+	}
+
+	var b []byte
+	b = appendString(b, 1, mf.GetName())
+	b = appendString(b, 2, mf.GetHelp())
+	b = appendMessage(b, field, data)
+	return b, len(points)
+}
+
+func startTime(created time.Time, ok bool, fallback time.Time) time.Time {
+	if ok {
+		return created
+	}
+	return fallback
+}
+
+// isNative 判断是否为 native histogram；同时带经典桶的也按 native 处理，与 Prometheus 抓取时一致
+func isNative(h *dto.Histogram) bool {
+	return h.Schema != nil
+}
+
+func numberPoint(attrs map[string]string, start, ts time.Time, v float64) []byte {
+	b := appendAttributes(nil, 7, attrs)
+	b = appendTime(b, 2, start)
+	b = appendTime(b, 3, ts)
+	return appendDouble(b, 4, v)
+}
+
+func summaryPoint(attrs map[string]string, start, ts time.Time, s *dto.Summary) []byte {
+	b := appendAttributes(nil, 7, attrs)
+	b = appendTime(b, 2, start)
+	b = appendTime(b, 3, ts)
+	b = appendFixed64(b, 4, s.GetSampleCount())
+	b = appendDouble(b, 5, s.GetSampleSum())
+	for _, q := range s.GetQuantile() {
+		var qb []byte
+		qb = appendDouble(qb, 1, q.GetQuantile())
+		qb = appendDouble(qb, 2, q.GetValue())
+		b = appendMessage(b, 6, qb)
+	}
+	return b
+}
+
+// histogramPoint 把 Prometheus 的累计桶转为 OTLP 的逐桶计数，+Inf 桶由总数补齐
+func histogramPoint(attrs map[string]string, start, ts time.Time, h *dto.Histogram) []byte {
+	count := sampleCount(h)
+	var bounds []float64
+	var counts []uint64
+	var prev uint64
+	for _, bucket := range h.GetBucket() {
+		if math.IsInf(bucket.GetUpperBound(), +1) {
+			continue
+		}
+		cum := bucket.GetCumulativeCount()
+		if f := bucket.GetCumulativeCountFloat(); f > 0 {
+			cum = uint64(math.Round(f))
+		}
+		bounds = append(bounds, bucket.GetUpperBound())
+		counts = append(counts, cum-prev)
+		prev = cum
+	}
+	counts = append(counts, count-min(prev, count))
+
+	b := appendAttributes(nil, 9, attrs)
+	b = appendTime(b, 2, start)
+	b = appendTime(b, 3, ts)
+	b = appendFixed64(b, 4, count)
+	b = appendDouble(b, 5, h.GetSampleSum())
+	var packed []byte
+	for _, c := range counts {
+		packed = protowire.AppendFixed64(packed, c)
+	}
+	b = appendMessage(b, 6, packed)
+	if len(bounds) > 0 {
+		packed = nil
+		for _, bound := range bounds {
+			packed = protowire.AppendFixed64(packed, math.Float64bits(bound))
+		}
+		b = appendMessage(b, 7, packed)
+	}
+	return b
+}
+
+// exponentialPoint 转换 native histogram。两者的 schema 与 scale 含义相同，
+// 但 Prometheus 第 i 个桶为 (base^(i-1), base^i]，OTLP 为 (base^i, base^(i+1)]，所以偏移量减一。
+func exponentialPoint(attrs map[string]string, start, ts time.Time, h *dto.Histogram) []byte {
+	zero := h.GetZeroCount()
+	if f := h.GetZeroCountFloat(); f > 0 {
+		zero = uint64(math.Round(f))
+	}
+	b := appendAttributes(nil, 1, attrs)
+	b = appendTime(b, 2, start)
+	b = appendTime(b, 3, ts)
+	b = appendFixed64(b, 4, sampleCount(h))
+	b = appendDouble(b, 5, h.GetSampleSum())
+	b = appendSint32(b, 6, h.GetSchema())
+	b = appendFixed64(b, 7, zero)
+	if offset, counts := expandBuckets(h.GetPositiveSpan(), h.GetPositiveDelta(), h.GetPositiveCount()); len(counts) > 0 {
+		b = appendMessage(b, 8, encodeBuckets(offset-1, counts))
+	}
+	if offset, counts := expandBuckets(h.GetNegativeSpan(), h.GetNegativeDelta(), h.GetNegativeCount()); len(counts) > 0 {
+		b = appendMessage(b, 9, encodeBuckets(offset-1, counts))
+	}
+	return appendDouble(b, 14, h.GetZeroThreshold())
+}
+
+func sampleCount(h *dto.Histogram) uint64 {
+	if f := h.GetSampleCountFloat(); f > 0 {
+		return uint64(math.Round(f))
+	}
+	return h.GetSampleCount()
+}
+
+// expandBuckets 把 span 稀疏表示展开为从 offset 开始的连续桶计数，span 之间的空桶补 0。
+// 整数 histogram 的计数为相对前一个桶的差值，浮点 histogram 为绝对值。
+func expandBuckets(spans []*dto.BucketSpan, deltas []int64, floats []float64) (int32, []uint64) {
+	var (
+		offset int32
+		counts []uint64
+		cur    int64
+		i      int
+	)
+	for n, span := range spans {
+		if n == 0 {
+			offset = span.GetOffset()
+		} else {
+			for range span.GetOffset() {
+				counts = append(counts, 0)
+			}
+		}
+		for range span.GetLength() {
+			switch {
+			case i < len(deltas):
+				cur += deltas[i]
+				counts = append(counts, uint64(cur))
+			case i < len(floats):
+				counts = append(counts, uint64(math.Round(floats[i])))
+			default:
+				return offset, counts
+			}
+			i++
+		}
+	}
+	return offset, counts
+}
+
+func encodeBuckets(offset int32, counts []uint64) []byte {
+	b := appendSint32(nil, 1, offset)
+	var packed []byte
+	for _, c := range counts {
+		packed = protowire.AppendVarint(packed, c)
+	}
+	return appendMessage(b, 2, packed)
+}
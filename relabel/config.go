@@ -0,0 +1,136 @@
+package relabel
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Action 与 Prometheus relabel_config 的 action 含义相同
+type Action string
+
+const (
+	Replace   Action = "replace"
+	Lowercase Action = "lowercase"
+	Uppercase Action = "uppercase"
+	Keep      Action = "keep"
+	Drop      Action = "drop"
+	LabelMap  Action = "labelmap"
+	LabelDrop Action = "labeldrop"
+	LabelKeep Action = "labelkeep"
+)
+
+var actions = []Action{Replace, Lowercase, Uppercase, Keep, Drop, LabelMap, LabelDrop, LabelKeep}
+
+// Config 为一条重写规则，字段和默认值与 Prometheus 的 metric_relabel_configs 一致。
+// 指标名通过 __name__ 标签读写。
+type Config struct {
+	SourceLabels []string `yaml:"source_labels,flow,omitempty"`
+	Separator    string   `yaml:"separator,omitempty"`
+	Regex        Regexp   `yaml:"regex,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+	Action       Action   `yaml:"action,omitempty"`
+}
+
+// DefaultConfig 为未填写字段的默认值
+var DefaultConfig = Config{
+	Separator:   ";",
+	Regex:       MustNewRegexp("(.*)"),
+	Replacement: "$1",
+	Action:      Replace,
+}
+
+var knownFields = []string{"source_labels", "separator", "regex", "target_label", "replacement", "action"}
+
+func (c *Config) UnmarshalYAML(value *yaml.Node) error {
+	// 自定义 UnmarshalYAML 时 KnownFields 不再生效，这里自己检查未知字段
+	if value.Kind == yaml.MappingNode {
+		for i := 0; i < len(value.Content); i += 2 {
+			if k := value.Content[i]; !slices.Contains(knownFields, k.Value) {
+				return fmt.Errorf("line %d: field %s not found in relabel config", k.Line, k.Value)
+			}
+		}
+	}
+
+	*c = DefaultConfig
+	type plain Config
+	if err := value.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	if !slices.Contains(actions, c.Action) {
+		return fmt.Errorf("unknown relabel action %q", c.Action)
+	}
+	switch c.Action {
+	case Replace, Lowercase, Uppercase:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel action %s requires target_label", c.Action)
+		}
+		// replace 的 target_label 可以引用正则分组，其余动作必须是合法标签名
+		if c.Action != Replace && !model.LabelName(c.TargetLabel).IsValid() {
+			return fmt.Errorf("invalid target_label %q", c.TargetLabel)
+		}
+	case LabelMap:
+		if !strings.Contains(c.Replacement, "$") && !model.LabelName(c.Replacement).IsValid() {
+			return fmt.Errorf("invalid labelmap replacement %q", c.Replacement)
+		}
+	case LabelDrop, LabelKeep:
+		if len(c.SourceLabels) > 0 || c.TargetLabel != "" {
+			return fmt.Errorf("relabel action %s only uses regex", c.Action)
+		}
+	}
+	return nil
+}
+
+// Regexp 为整体锚定的正则，与 Prometheus 相同
+type Regexp struct {
+	*regexp.Regexp
+	original string
+}
+
+// NewRegexp compiles s anchored at both ends.
+func NewRegexp(s string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	return Regexp{Regexp: re, original: s}, err
+}
+
+func MustNewRegexp(s string) Regexp {
+	re, err := NewRegexp(s)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+func (re *Regexp) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	r, err := NewRegexp(s)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid regex %q: %w", value.Line, s, err)
+	}
+	*re = r
+	return nil
+}
+
+func (re Regexp) MarshalYAML() (any, error) {
+	return re.original, nil
+}
+
+// IsZero 让 omitempty 能省略未设置的正则
+func (re Regexp) IsZero() bool {
+	return re.Regexp == nil
+}
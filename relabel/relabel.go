@@ -0,0 +1,176 @@
+package relabel
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// Apply runs the rules over lset in order and reports whether the series is
+// kept. lset is modified in place, an empty value removes the label.
+func Apply(lset map[string]string, cfgs []*Config) bool {
+	for _, cfg := range cfgs {
+		if !apply(lset, cfg) {
+			return false
+		}
+	}
+	return true
+}
+
+func apply(lset map[string]string, cfg *Config) bool {
+	values := make([]string, 0, len(cfg.SourceLabels))
+	for _, name := range cfg.SourceLabels {
+		values = append(values, lset[name])
+	}
+	val := strings.Join(values, cfg.Separator)
+
+	switch cfg.Action {
+	case Drop:
+		return !cfg.Regex.MatchString(val)
+	case Keep:
+		return cfg.Regex.MatchString(val)
+	case Replace:
+		indexes := cfg.Regex.FindStringSubmatchIndex(val)
+		if indexes == nil {
+			break
+		}
+		target := string(cfg.Regex.ExpandString(nil, cfg.TargetLabel, val, indexes))
+		if !model.LabelName(target).IsValid() {
+			break
+		}
+		setLabel(lset, target, string(cfg.Regex.ExpandString(nil, cfg.Replacement, val, indexes)))
+	case Lowercase:
+		setLabel(lset, cfg.TargetLabel, strings.ToLower(val))
+	case Uppercase:
+		setLabel(lset, cfg.TargetLabel, strings.ToUpper(val))
+	case LabelMap:
+		// 遍历 map 时写入的新键可能被再次遍历到，先收集结果再合并
+		mapped := make(map[string]string)
+		for name, v := range lset {
+			if cfg.Regex.MatchString(name) {
+				mapped[cfg.Regex.ReplaceAllString(name, cfg.Replacement)] = v
+			}
+		}
+		maps.Copy(lset, mapped)
+	case LabelDrop:
+		for name := range lset {
+			if name != model.MetricNameLabel && cfg.Regex.MatchString(name) {
+				delete(lset, name)
+			}
+		}
+	case LabelKeep:
+		for name := range lset {
+			if name != model.MetricNameLabel && !cfg.Regex.MatchString(name) {
+				delete(lset, name)
+			}
+		}
+	}
+	return true
+}
+
+func setLabel(lset map[string]string, name, value string) {
+	if value == "" {
+		delete(lset, name)
+		return
+	}
+	lset[name] = value
+}
+
+// Process relabels gathered metric families. The metric name is exposed to
+// the rules as __name__, so rules can drop, keep or rename whole metrics.
+// The input is not modified, it may be shared with a scrape cache.
+func Process(mfs []*dto.MetricFamily, cfgs []*Config) []*dto.MetricFamily {
+	if len(cfgs) == 0 {
+		return mfs
+	}
+
+	families := make(map[string]*dto.MetricFamily)
+	seen := make(map[string]bool)
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			lset := map[string]string{model.MetricNameLabel: mf.GetName()}
+			for _, lp := range m.Label {
+				lset[lp.GetName()] = lp.GetValue()
+			}
+			if !Apply(lset, cfgs) {
+				continue
+			}
+			name := lset[model.MetricNameLabel]
+			delete(lset, model.MetricNameLabel)
+			if !model.IsValidMetricName(model.LabelValue(name)) {
+				continue
+			}
+
+			fam, ok := families[name]
+			if !ok {
+				fam = &dto.MetricFamily{Name: proto.String(name), Help: mf.Help, Type: mf.Type, Unit: mf.Unit}
+				families[name] = fam
+			}
+			// 重命名后与已有指标类型冲突的序列无法合法导出，丢弃
+			if fam.GetType() != mf.GetType() {
+				continue
+			}
+
+			out := proto.Clone(m).(*dto.Metric)
+			out.Label = labelPairs(lset)
+			// 删除标签后可能出现重复序列，只保留第一个
+			if key := seriesKey(name, out.Label); seen[key] {
+				continue
+			} else {
+				seen[key] = true
+			}
+			fam.Metric = append(fam.Metric, out)
+		}
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, fam := range families {
+		if len(fam.Metric) > 0 {
+			result = append(result, fam)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result
+}
+
+func labelPairs(lset map[string]string) []*dto.LabelPair {
+	names := make([]string, 0, len(lset))
+	for name := range lset {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	pairs := make([]*dto.LabelPair, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, &dto.LabelPair{Name: proto.String(name), Value: proto.String(lset[name])})
+	}
+	return pairs
+}
+
+func seriesKey(name string, pairs []*dto.LabelPair) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, lp := range pairs {
+		b.WriteByte(0)
+		b.WriteString(lp.GetName())
+		b.WriteByte(0)
+		b.WriteString(lp.GetValue())
+	}
+	return b.String()
+}
+
+// Gatherer wraps g so that every Gather is relabeled with cfgs.
+func Gatherer(g prometheus.Gatherer, cfgs []*Config) prometheus.Gatherer {
+	if len(cfgs) == 0 {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		return Process(mfs, cfgs), err
+	})
+}
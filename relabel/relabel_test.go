@@ -0,0 +1,198 @@
+package relabel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+func gauge(name string, value float64, labels ...string) *dto.MetricFamily {
+	m := &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(value)}}
+	for i := 0; i < len(labels); i += 2 {
+		m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(labels[i]), Value: proto.String(labels[i+1])})
+	}
+	return &dto.MetricFamily{Name: proto.String(name), Help: proto.String(name + "."), Type: dto.MetricType_GAUGE.Enum(), Metric: []*dto.Metric{m}}
+}
+
+func text(t *testing.T, mfs []*dto.MetricFamily) string {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func TestProcess(t *testing.T) {
+	input := func() []*dto.MetricFamily {
+		return []*dto.MetricFamily{
+			gauge("cpu", 1, "core", "0", "mode", "idle"),
+			gauge("cpu", 2, "core", "1", "mode", "user"),
+			gauge("mem", 3, "__meta_zone", "a", "host", "h1"),
+		}
+	}
+	for _, tc := range []struct {
+		name  string
+		rules string
+		input []*dto.MetricFamily
+		want  string
+	}{
+		{
+			name: "keep",
+			rules: `
+- source_labels: [mode]
+  regex: idle
+  action: keep`,
+			want: `# HELP cpu cpu.
+# TYPE cpu gauge
+cpu{core="0",mode="idle"} 1
+`,
+		},
+		{
+			name: "drop by metric name",
+			rules: `
+- source_labels: [__name__]
+  regex: cpu
+  action: drop`,
+			want: `# HELP mem mem.
+# TYPE mem gauge
+mem{__meta_zone="a",host="h1"} 3
+`,
+		},
+		{
+			name: "replace with groups",
+			rules: `
+- source_labels: [__name__, host]
+  regex: (mem);(h\d)
+  target_label: node
+  replacement: $2-$1`,
+			want: `# HELP cpu cpu.
+# TYPE cpu gauge
+cpu{core="0",mode="idle"} 1
+cpu{core="1",mode="user"} 2
+# HELP mem mem.
+# TYPE mem gauge
+mem{__meta_zone="a",host="h1",node="h1-mem"} 3
+`,
+		},
+		{
+			name: "rename metric",
+			rules: `
+- source_labels: [__name__]
+  regex: mem
+  target_label: __name__
+  replacement: memory_bytes`,
+			want: `# HELP cpu cpu.
+# TYPE cpu gauge
+cpu{core="0",mode="idle"} 1
+cpu{core="1",mode="user"} 2
+# HELP memory_bytes mem.
+# TYPE memory_bytes gauge
+memory_bytes{__meta_zone="a",host="h1"} 3
+`,
+		},
+		{
+			name: "labeldrop",
+			rules: `
+- regex: __meta_.*|mode
+  action: labeldrop`,
+			want: `# HELP cpu cpu.
+# TYPE cpu gauge
+cpu{core="0"} 1
+cpu{core="1"} 2
+# HELP mem mem.
+# TYPE mem gauge
+mem{host="h1"} 3
+`,
+		},
+		{
+			name: "labelkeep keeps the metric name",
+			rules: `
+- regex: core|host
+  action: labelkeep`,
+			want: `# HELP cpu cpu.
+# TYPE cpu gauge
+cpu{core="0"} 1
+cpu{core="1"} 2
+# HELP mem mem.
+# TYPE mem gauge
+mem{host="h1"} 3
+`,
+		},
+		{
+			// 映射出的 zone 不会在同一次遍历中再被匹配
+			name: "labelmap",
+			rules: `
+- regex: __meta_(.+)
+  replacement: $1
+  action: labelmap
+- regex: __meta_.*
+  action: labeldrop`,
+			input: []*dto.MetricFamily{gauge("mem", 3, "__meta_zone", "a", "__meta_rack", "r1")},
+			want: `# HELP mem mem.
+# TYPE mem gauge
+mem{rack="r1",zone="a"} 3
+`,
+		},
+		{
+			name: "duplicate series after labeldrop",
+			rules: `
+- regex: core
+  action: labeldrop`,
+			input: []*dto.MetricFamily{
+				gauge("cpu", 1, "core", "0", "mode", "idle"),
+				gauge("cpu", 2, "core", "1", "mode", "idle"),
+			},
+			want: `# HELP cpu cpu.
+# TYPE cpu gauge
+cpu{mode="idle"} 1
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfgs []*Config
+			if err := yaml.Unmarshal([]byte(tc.rules), &cfgs); err != nil {
+				t.Fatal(err)
+			}
+			in := tc.input
+			if in == nil {
+				in = input()
+			}
+			before := text(t, in)
+			got := text(t, Process(in, cfgs))
+			if got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+			// 输入可能被采集缓存共享，不能被修改
+			if after := text(t, in); after != before {
+				t.Errorf("input was modified:\n%s\nwas:\n%s", after, before)
+			}
+		})
+	}
+}
+
+func TestApplyLabelMapChain(t *testing.T) {
+	// 替换结果再次匹配正则时，只按原有标签映射一次
+	lset := map[string]string{"a": "1"}
+	cfg := DefaultConfig
+	cfg.Action = LabelMap
+	cfg.Regex = MustNewRegexp("(a+)")
+	cfg.Replacement = "${1}a"
+	if !Apply(lset, []*Config{&cfg}) {
+		t.Fatal("series dropped")
+	}
+	var names []string
+	for name := range lset {
+		names = append(names, name)
+	}
+	if len(lset) != 2 || lset["aa"] != "1" {
+		t.Errorf("got labels %s, want a and aa", strings.Join(names, ","))
+	}
+}
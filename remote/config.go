@@ -0,0 +1,67 @@
+// Package remote pushes gathered samples to a Prometheus remote-write
+// endpoint for sites that only allow outbound traffic.
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Config 为 remote write 配置，url 为空时不发送
+type Config struct {
+	URL               string            `yaml:"url"`
+	Interval          model.Duration    `yaml:"interval"` // 采集间隔
+	Timeout           model.Duration    `yaml:"timeout"`  // 单次请求超时
+	Headers           map[string]string `yaml:"headers,omitempty"`
+	ExternalLabels    map[string]string `yaml:"external_labels,omitempty"` // 序列中没有同名标签时添加
+	QueueCapacity     int               `yaml:"queue_capacity"`            // 内存中最多缓存的样本数，满时丢弃最旧的样本
+	MaxSamplesPerSend int               `yaml:"max_samples_per_send"`
+	MinBackoff        model.Duration    `yaml:"min_backoff"`
+	MaxBackoff        model.Duration    `yaml:"max_backoff"`
+}
+
+// DefaultConfig 与 Prometheus queue_config 的默认值接近
+var DefaultConfig = Config{
+	Interval:          model.Duration(15 * time.Second),
+	Timeout:           model.Duration(30 * time.Second),
+	QueueCapacity:     10000,
+	MaxSamplesPerSend: 2000,
+	MinBackoff:        model.Duration(30 * time.Millisecond),
+	MaxBackoff:        model.Duration(5 * time.Second),
+}
+
+// Enabled reports whether a remote-write URL is configured.
+func (c *Config) Enabled() bool {
+	return c.URL != ""
+}
+
+// Validate checks the settings that the YAML decoder cannot.
+func (c *Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", c.URL)
+	}
+	if c.Interval <= 0 || c.Timeout <= 0 {
+		return errors.New("interval and timeout must be positive")
+	}
+	if c.MaxSamplesPerSend <= 0 || c.QueueCapacity < c.MaxSamplesPerSend {
+		return errors.New("max_samples_per_send must be positive and not larger than queue_capacity")
+	}
+	if c.MinBackoff <= 0 || c.MaxBackoff < c.MinBackoff {
+		return errors.New("min_backoff must be positive and not larger than max_backoff")
+	}
+	for name := range c.ExternalLabels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid external label name %q", name)
+		}
+	}
+	return nil
+}
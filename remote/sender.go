@@ -0,0 +1,277 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/version"
+)
+
+type entry struct {
+	labels []label
+	sample
+}
+
+// Sender 把样本缓存在有界队列中，由单个 goroutine 分批发送，保证同一序列按时间顺序送达。
+// 队列跨配置重载保留。
+type Sender struct {
+	logger *slog.Logger
+	client *http.Client
+
+	mu     sync.Mutex
+	cfg    Config
+	queue  []entry
+	notify chan struct{}
+
+	sent    prometheus.Counter
+	failed  prometheus.Counter
+	dropped prometheus.Counter
+	retries prometheus.Counter
+	pending *prometheus.Desc
+}
+
+func NewSender(logger *slog.Logger) *Sender {
+	return &Sender{
+		logger: logger,
+		client: &http.Client{},
+		cfg:    DefaultConfig,
+		notify: make(chan struct{}, 1),
+		sent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_remote_write_samples_total",
+			Help: "Samples successfully sent to the remote-write endpoint.",
+		}),
+		failed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_remote_write_samples_failed_total",
+			Help: "Samples rejected by the remote-write endpoint with a non-recoverable error.",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_remote_write_samples_dropped_total",
+			Help: "Samples dropped because the queue was full.",
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_remote_write_retries_total",
+			Help: "Remote-write requests retried after a recoverable error.",
+		}),
+		pending: prometheus.NewDesc("exporter_remote_write_pending_samples",
+			"Samples waiting in the queue.", nil, nil),
+	}
+}
+
+// SetConfig applies cfg. Disabling remote write drops the queued samples.
+func (s *Sender) SetConfig(cfg Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
+	if !cfg.Enabled() {
+		s.queue = nil
+	}
+}
+
+func (s *Sender) config() Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// Run gathers g every interval and sends the samples until ctx is done.
+func (s *Sender) Run(ctx context.Context, g prometheus.Gatherer) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.shipLoop(ctx)
+	}()
+	defer wg.Wait()
+
+	ticker := time.NewTicker(time.Duration(s.config().Interval))
+	defer ticker.Stop()
+	for {
+		s.gather(g)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sender) gather(g prometheus.Gatherer) {
+	// Gather 出错时仍会返回其余指标，照常发送
+	mfs, _ := g.Gather()
+	samples, _ := expfmt.ExtractSamples(&expfmt.DecodeOptions{Timestamp: model.Now()}, mfs...)
+
+	cfg := s.config()
+	entries := make([]entry, 0, len(samples))
+	for _, smpl := range samples {
+		labels := make([]label, 0, len(smpl.Metric)+len(cfg.ExternalLabels))
+		for name, value := range smpl.Metric {
+			labels = append(labels, label{string(name), string(value)})
+		}
+		for name, value := range cfg.ExternalLabels {
+			if _, ok := smpl.Metric[model.LabelName(name)]; !ok {
+				labels = append(labels, label{name, value})
+			}
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+		entries = append(entries, entry{labels, sample{float64(smpl.Value), int64(smpl.Timestamp)}})
+	}
+	s.enqueue(entries, false)
+}
+
+// enqueue 追加到队尾，front 为 true 时放回队首（用于未发送完的批次）。超出容量时丢弃最旧的样本。
+func (s *Sender) enqueue(entries []entry, front bool) {
+	s.mu.Lock()
+	if front {
+		s.queue = append(entries, s.queue...)
+	} else {
+		s.queue = append(s.queue, entries...)
+	}
+	if over := len(s.queue) - s.cfg.QueueCapacity; over > 0 {
+		s.queue = append([]entry(nil), s.queue[over:]...)
+		s.dropped.Add(float64(over))
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Sender) take(n int) []entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n = min(n, len(s.queue))
+	batch := s.queue[:n:n]
+	s.queue = s.queue[n:]
+	return batch
+}
+
+func (s *Sender) shipLoop(ctx context.Context) {
+	for {
+		batch := s.take(s.config().MaxSamplesPerSend)
+		if len(batch) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.notify:
+			}
+			continue
+		}
+		if err := s.sendBatch(ctx, batch); err != nil {
+			if ctx.Err() != nil {
+				// 重载或退出时把批次放回队列，由下一个 shipLoop 继续发送
+				s.enqueue(batch, true)
+				return
+			}
+			s.failed.Add(float64(len(batch)))
+			s.logger.Error("Remote write failed, dropping samples", "samples", len(batch), "err", err)
+			continue
+		}
+		s.sent.Add(float64(len(batch)))
+	}
+}
+
+// sendBatch 发送一批样本，可恢复的错误（网络错误、5xx、429）按指数退避一直重试
+func (s *Sender) sendBatch(ctx context.Context, batch []entry) error {
+	body := snappy.Encode(nil, encodeWriteRequest(groupSeries(batch)))
+	cfg := s.config()
+	backoff := time.Duration(cfg.MinBackoff)
+	for {
+		recoverable, err := s.post(ctx, cfg, body)
+		if err == nil || !recoverable {
+			return err
+		}
+		s.retries.Inc()
+		s.logger.Warn("Remote write failed, retrying", "backoff", backoff.String(), "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Duration(cfg.MaxBackoff))
+	}
+}
+
+func (s *Sender) post(ctx context.Context, cfg Config, body []byte) (recoverable bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "exporter/"+version.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// groupSeries 把同一序列的样本合并到一个 TimeSeries，保持样本顺序
+func groupSeries(batch []entry) []timeSeries {
+	index := make(map[string]int)
+	var series []timeSeries
+	for _, e := range batch {
+		var key strings.Builder
+		for _, l := range e.labels {
+			key.WriteString(l.name)
+			key.WriteByte(0)
+			key.WriteString(l.value)
+			key.WriteByte(0)
+		}
+		i, ok := index[key.String()]
+		if !ok {
+			i = len(series)
+			index[key.String()] = i
+			series = append(series, timeSeries{labels: e.labels})
+		}
+		series[i].samples = append(series[i].samples, e.sample)
+	}
+	return series
+}
+
+func (s *Sender) Describe(ch chan<- *prometheus.Desc) {
+	s.sent.Describe(ch)
+	s.failed.Describe(ch)
+	s.dropped.Describe(ch)
+	s.retries.Describe(ch)
+	ch <- s.pending
+}
+
+func (s *Sender) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	n := len(s.queue)
+	s.mu.Unlock()
+	s.sent.Collect(ch)
+	s.failed.Collect(ch)
+	s.dropped.Collect(ch)
+	s.retries.Collect(ch)
+	ch <- prometheus.MustNewConstMetric(s.pending, prometheus.GaugeValue, float64(n))
+}
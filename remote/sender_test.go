@@ -0,0 +1,342 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// writeRequestDesc 为 prompb.WriteRequest 的消息定义。测试不依赖 prometheus 模块，
+// 用 dynamicpb 按同一定义独立解码，而不是复用 proto.go 的编码逻辑
+var writeRequestDesc = func() protoreflect.MessageDescriptor {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, repeated bool, typeName string) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), Label: label.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("prompb/remote.proto"),
+		Package: proto.String("prometheus"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("WriteRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("timeseries", 1, msg, true, ".prometheus.TimeSeries"),
+			}},
+			{Name: proto.String("TimeSeries"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("labels", 1, msg, true, ".prometheus.Label"),
+				field("samples", 2, msg, true, ".prometheus.Sample"),
+			}},
+			{Name: proto.String("Label"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+				field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+			}},
+			{Name: proto.String("Sample"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("value", 1, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, false, ""),
+				field("timestamp", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, false, ""),
+			}},
+		},
+	}, nil)
+	if err != nil {
+		panic(err)
+	}
+	return fd.Messages().ByName("WriteRequest")
+}()
+
+// decodeWriteRequest 解压并解码请求体，返回序列
+func decodeWriteRequest(body []byte) ([]timeSeries, error) {
+	raw, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, err
+	}
+	req := dynamicpb.NewMessage(writeRequestDesc)
+	if err := proto.Unmarshal(raw, req); err != nil {
+		return nil, err
+	}
+	var out []timeSeries
+	list := req.Get(writeRequestDesc.Fields().ByName("timeseries")).List()
+	for i := 0; i < list.Len(); i++ {
+		ts := list.Get(i).Message()
+		var series timeSeries
+		labels := ts.Get(ts.Descriptor().Fields().ByName("labels")).List()
+		for j := 0; j < labels.Len(); j++ {
+			l := labels.Get(j).Message()
+			fields := l.Descriptor().Fields()
+			series.labels = append(series.labels, label{l.Get(fields.ByName("name")).String(), l.Get(fields.ByName("value")).String()})
+		}
+		samples := ts.Get(ts.Descriptor().Fields().ByName("samples")).List()
+		for j := 0; j < samples.Len(); j++ {
+			s := samples.Get(j).Message()
+			fields := s.Descriptor().Fields()
+			series.samples = append(series.samples, sample{s.Get(fields.ByName("value")).Float(), s.Get(fields.ByName("timestamp")).Int()})
+		}
+		out = append(out, series)
+	}
+	return out, nil
+}
+
+// receiver 解码收到的请求，status 依次决定每个请求的响应码，用完后返回 204
+type receiver struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	status   []int
+	requests [][]timeSeries // 成功接收的请求
+	attempts int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for k, want := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"Authorization":                     "Bearer secret",
+	} {
+		if got := r.Header.Get(k); got != want {
+			rc.t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+	body, _ := io.ReadAll(r.Body)
+	series, err := decodeWriteRequest(body)
+	if err != nil {
+		rc.t.Errorf("decoding request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.attempts++
+	code := http.StatusNoContent
+	if len(rc.status) > 0 {
+		code, rc.status = rc.status[0], rc.status[1:]
+	}
+	if code/100 == 2 {
+		rc.requests = append(rc.requests, series)
+	}
+	w.WriteHeader(code)
+}
+
+func (rc *receiver) received() (attempts int, requests [][]timeSeries) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.attempts, rc.requests
+}
+
+func newTestSender(url string, capacity, perSend int) *Sender {
+	s := NewSender(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	cfg := DefaultConfig
+	cfg.URL = url
+	cfg.Headers = map[string]string{"Authorization": "Bearer secret"}
+	cfg.QueueCapacity = capacity
+	cfg.MaxSamplesPerSend = perSend
+	cfg.MinBackoff = model.Duration(time.Millisecond)
+	cfg.MaxBackoff = model.Duration(2 * time.Millisecond)
+	s.SetConfig(cfg)
+	return s
+}
+
+// ship 运行 shipLoop 直到 done 成立
+func ship(t *testing.T, s *Sender, done func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.shipLoop(ctx)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-stopped
+}
+
+func entries(n int) []entry {
+	out := make([]entry, n)
+	for i := range out {
+		out[i] = entry{[]label{{"__name__", "x"}}, sample{float64(i), int64(i)}}
+	}
+	return out
+}
+
+func TestSendBatches(t *testing.T) {
+	rc := &receiver{t: t}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	s := newTestSender(srv.URL, 100, 3)
+	cfg := s.config()
+	cfg.ExternalLabels = map[string]string{"cluster": "c1", "job": "ignored"}
+	s.SetConfig(cfg)
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "g", Help: "G."}, []string{"job"})
+	reg.MustRegister(g)
+	g.WithLabelValues("a").Set(1)
+	g.WithLabelValues("b").Set(2)
+	for i := 0; i < 3; i++ {
+		s.gather(reg)
+		g.WithLabelValues("a").Add(1)
+	}
+	s.enqueue(entries(1), false)
+
+	ship(t, s, func() bool { return testutil.ToFloat64(s.sent) == 7 })
+	_, requests := rc.received()
+	var sizes []int
+	values := make(map[string][]float64)
+	for _, series := range requests {
+		n := 0
+		for _, ts := range series {
+			n += len(ts.samples)
+			var key string
+			for i, l := range ts.labels {
+				if i > 0 && ts.labels[i-1].name >= l.name {
+					t.Errorf("labels not sorted: %v", ts.labels)
+				}
+				key += l.name + "=" + l.value + ","
+			}
+			for _, smpl := range ts.samples {
+				values[key] = append(values[key], smpl.value)
+			}
+		}
+		sizes = append(sizes, n)
+	}
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Errorf("batch sizes = %v, want [3 3 1]", sizes)
+	}
+	// 外部标签不覆盖已有的同名标签，同一序列的样本按采集顺序送达
+	want := map[string][]float64{
+		"__name__=g,cluster=c1,job=a,": {1, 2, 3},
+		"__name__=g,cluster=c1,job=b,": {2, 2, 2},
+		"__name__=x,":                  {0},
+	}
+	for key, w := range want {
+		if got := values[key]; len(got) != len(w) || got[0] != w[0] || got[len(got)-1] != w[len(w)-1] {
+			t.Errorf("%s: got %v, want %v", key, got, w)
+		}
+	}
+	if len(values) != len(want) {
+		t.Errorf("got series %v", values)
+	}
+}
+
+func TestSendRetry(t *testing.T) {
+	rc := &receiver{t: t, status: []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	s := newTestSender(srv.URL, 100, 10)
+	s.enqueue(entries(5), false)
+
+	ship(t, s, func() bool { return testutil.ToFloat64(s.sent) == 5 })
+	attempts, requests := rc.received()
+	if attempts != 4 || len(requests) != 1 {
+		t.Errorf("attempts = %d, delivered = %d; want 4 and 1", attempts, len(requests))
+	}
+	if got := testutil.ToFloat64(s.retries); got != 3 {
+		t.Errorf("retries = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(s.failed); got != 0 {
+		t.Errorf("failed = %v, want 0", got)
+	}
+}
+
+func TestSendDropOn4xx(t *testing.T) {
+	rc := &receiver{t: t, status: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	s := newTestSender(srv.URL, 100, 2)
+	s.enqueue(entries(4), false)
+
+	// 第一批被拒绝后丢弃，不重试，第二批照常发送
+	ship(t, s, func() bool { return testutil.ToFloat64(s.sent) == 2 })
+	attempts, requests := rc.received()
+	if attempts != 2 || len(requests) != 1 {
+		t.Errorf("attempts = %d, delivered = %d; want 2 and 1", attempts, len(requests))
+	}
+	if got := requests[0][0].samples[0].value; got != 2 {
+		t.Errorf("delivered batch starts at %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(s.failed); got != 2 {
+		t.Errorf("failed = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(s.retries); got != 0 {
+		t.Errorf("retries = %v, want 0", got)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	rc := &receiver{t: t}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	s := newTestSender(srv.URL, 5, 5)
+
+	// 没有 shipLoop 消费时超出容量的最旧样本被丢弃
+	s.enqueue(entries(8), false)
+	if got := testutil.ToFloat64(s.dropped); got != 3 {
+		t.Errorf("dropped = %v, want 3", got)
+	}
+	if err := testutil.CollectAndCompare(s, strings.NewReader(`
+# HELP exporter_remote_write_pending_samples Samples waiting in the queue.
+# TYPE exporter_remote_write_pending_samples gauge
+exporter_remote_write_pending_samples 5
+`), "exporter_remote_write_pending_samples"); err != nil {
+		t.Error(err)
+	}
+
+	ship(t, s, func() bool { return testutil.ToFloat64(s.sent) == 5 })
+	_, requests := rc.received()
+	got := requests[0][0].samples
+	if len(got) != 5 || got[0].value != 3 || got[4].value != 7 {
+		t.Errorf("sent %v, want the newest 5 samples", got)
+	}
+}
+
+// 重载时未发送完的批次放回队首，由下一个 shipLoop 发送
+func TestSendRequeueOnCancel(t *testing.T) {
+	rc := &receiver{t: t, status: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	s := newTestSender(srv.URL, 100, 3)
+	cfg := s.config()
+	cfg.MinBackoff = model.Duration(time.Hour)
+	cfg.MaxBackoff = model.Duration(time.Hour)
+	s.SetConfig(cfg)
+	s.enqueue(entries(4), false)
+
+	ship(t, s, func() bool { attempts, _ := rc.received(); return attempts == 1 })
+	cfg.MinBackoff = model.Duration(time.Millisecond)
+	cfg.MaxBackoff = model.Duration(time.Millisecond)
+	s.SetConfig(cfg)
+	ship(t, s, func() bool { return testutil.ToFloat64(s.sent) == 4 })
+
+	_, requests := rc.received()
+	if len(requests) != 2 || requests[0][0].samples[0].value != 0 || requests[1][0].samples[0].value != 3 {
+		t.Errorf("delivered %v, want the requeued batch first", requests)
+	}
+}
@@ -0,0 +1,167 @@
+package web
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config 与 Prometheus exporter-toolkit 的 web 配置文件格式兼容
+type Config struct {
+	TLSConfig      TLSConfig         `yaml:"tls_server_config"`
+	HTTPConfig     HTTPConfig        `yaml:"http_server_config"`
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+}
+
+type TLSConfig struct {
+	CertFile                 string   `yaml:"cert_file"`
+	KeyFile                  string   `yaml:"key_file"`
+	ClientAuth               string   `yaml:"client_auth_type"`
+	ClientCAs                string   `yaml:"client_ca_file"`
+	CipherSuites             []string `yaml:"cipher_suites"`
+	CurvePreferences         []string `yaml:"curve_preferences"`
+	MinVersion               string   `yaml:"min_version"`
+	MaxVersion               string   `yaml:"max_version"`
+	PreferServerCipherSuites bool     `yaml:"prefer_server_cipher_suites"`
+}
+
+type HTTPConfig struct {
+	HTTP2   bool              `yaml:"http2"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Enabled reports whether TLS is configured.
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// LoadConfig reads a web config file. Relative certificate paths are
+// resolved against the directory of the file.
+func LoadConfig(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{
+		TLSConfig:  TLSConfig{MinVersion: "TLS12"},
+		HTTPConfig: HTTPConfig{HTTP2: true},
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	dir := filepath.Dir(filename)
+	for _, p := range []*string{&cfg.TLSConfig.CertFile, &cfg.TLSConfig.KeyFile, &cfg.TLSConfig.ClientCAs} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	return cfg, nil
+}
+
+var tlsVersions = map[string]uint16{
+	"TLS13": tls.VersionTLS13,
+	"TLS12": tls.VersionTLS12,
+	"TLS11": tls.VersionTLS11,
+	"TLS10": tls.VersionTLS10,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+var curves = map[string]tls.CurveID{
+	"CurveP256": tls.CurveP256,
+	"CurveP384": tls.CurveP384,
+	"CurveP521": tls.CurveP521,
+	"X25519":    tls.X25519,
+}
+
+// ServerConfig builds a *tls.Config, reading the certificate, key and
+// client CA from disk on every call.
+func (c *TLSConfig) ServerConfig() (*tls.Config, error) {
+	if c.CertFile == "" {
+		return nil, errors.New("missing cert_file")
+	}
+	if c.KeyFile == "" {
+		return nil, errors.New("missing key_file")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load X509KeyPair: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates:             []tls.Certificate{cert},
+		PreferServerCipherSuites: c.PreferServerCipherSuites,
+	}
+	var ok bool
+	if cfg.MinVersion, ok = tlsVersions[c.MinVersion]; !ok {
+		return nil, fmt.Errorf("unknown min_version %q", c.MinVersion)
+	}
+	if c.MaxVersion != "" {
+		if cfg.MaxVersion, ok = tlsVersions[c.MaxVersion]; !ok {
+			return nil, fmt.Errorf("unknown max_version %q", c.MaxVersion)
+		}
+	}
+	for _, name := range c.CipherSuites {
+		id, err := cipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+	for _, name := range c.CurvePreferences {
+		id, ok := curves[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q", name)
+		}
+		cfg.CurvePreferences = append(cfg.CurvePreferences, id)
+	}
+
+	if c.ClientCAs != "" {
+		pem, err := os.ReadFile(c.ClientCAs)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.ClientCAs)
+		}
+		cfg.ClientCAs = pool
+	}
+	if cfg.ClientAuth, ok = clientAuthTypes[c.ClientAuth]; !ok {
+		return nil, fmt.Errorf("invalid client_auth_type %q", c.ClientAuth)
+	}
+	// 只配置了 CA 时默认要求并校验客户端证书
+	if c.ClientAuth == "" && c.ClientCAs != "" {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if c.ClientCAs == "" && cfg.ClientAuth >= tls.VerifyClientCertIfGiven {
+		return nil, fmt.Errorf("client_auth_type %s requires client_ca_file", c.ClientAuth)
+	}
+	return cfg, nil
+}
+
+func cipherSuite(name string) (uint16, error) {
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if cs.Name == name {
+			return cs.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown cipher suite %q", name)
+}
@@ -0,0 +1,120 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unixPrefix 标识 unix domain socket 地址，如 unix:/run/exporter.sock
+const unixPrefix = "unix:"
+
+// ListenConfig 描述要监听的地址
+type ListenConfig struct {
+	// Addresses 为 host:port 或 unix:/path 形式
+	Addresses []string
+	// UnixSocketMode 为 unix socket 文件的权限
+	UnixSocketMode os.FileMode
+	// SystemdSocket 为 true 时只使用 systemd 通过 LISTEN_FDS 传入的监听套接字
+	SystemdSocket bool
+}
+
+// ValidateAddress checks a single listen address.
+func ValidateAddress(addr string) error {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		if path == "" {
+			return errors.New("empty unix socket path")
+		}
+		return nil
+	}
+	_, _, err := net.SplitHostPort(addr)
+	return err
+}
+
+// Listen opens all listeners of cfg, closing the ones already opened if any
+// of them fails.
+func Listen(cfg ListenConfig) ([]net.Listener, error) {
+	if cfg.SystemdSocket {
+		return systemdListeners(systemdListenFdsStart)
+	}
+
+	var listeners []net.Listener
+	for _, addr := range cfg.Addresses {
+		l, err := listen(addr, cfg.UnixSocketMode)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func listen(addr string, mode os.FileMode) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// 清理上次异常退出留下的 socket 文件
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// systemdListenFdsStart 为 sd_listen_fds(3) 中的 SD_LISTEN_FDS_START
+const systemdListenFdsStart = 3
+
+// systemdListeners 读取 systemd socket activation 传入的、从 start 开始的文件描述符
+func systemdListeners(start int) ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd, LISTEN_PID is not set to this process")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, errors.New("no sockets passed by systemd, LISTEN_FDS is not set")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(start+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(start+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket %s passed by systemd: %w", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// passFds 把 listeners 的文件描述符复制到从 start 开始的位置，模拟 systemd 传入的套接字
+func passFds(t *testing.T, start int, listeners ...net.Listener) {
+	t.Helper()
+	for i, l := range listeners {
+		f, err := l.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := unix.Dup3(int(f.Fd()), start+i, unix.O_CLOEXEC); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	// 远大于测试进程已用的描述符，避免覆盖
+	const start = 1000
+	var originals []net.Listener
+	for range 2 {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		originals = append(originals, l)
+	}
+	passFds(t, start, originals...)
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "web")
+
+	listeners, err := systemdListeners(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	if len(listeners) != 2 {
+		t.Fatalf("got %d listeners, want 2", len(listeners))
+	}
+	for i, l := range listeners {
+		if got, want := l.Addr().String(), originals[i].Addr().String(); got != want {
+			t.Errorf("listener %d on %s, want %s", i, got, want)
+		}
+	}
+	// 环境变量只对本进程有效，读取后清除，避免传给子进程
+	for _, env := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if v, ok := os.LookupEnv(env); ok {
+			t.Errorf("%s = %q was not unset", env, v)
+		}
+	}
+}
+
+func TestSystemdListenersErrors(t *testing.T) {
+	const start = 1000
+	pid := strconv.Itoa(os.Getpid())
+	for _, tc := range []struct {
+		name  string
+		pid   string
+		fds   string
+		names string
+		want  string
+	}{
+		{"other process", strconv.Itoa(os.Getpid() + 1), "1", "", "LISTEN_PID"},
+		{"no pid", "", "1", "", "LISTEN_PID"},
+		{"no fds", pid, "", "", "LISTEN_FDS"},
+		{"zero fds", pid, "0", "", "LISTEN_FDS"},
+		// 描述符未打开，错误中带上 LISTEN_FDNAMES 给出的名称
+		{"closed fd", pid, "1", "metrics", "socket metrics"},
+		{"closed fd without name", pid, "1", "", "socket LISTEN_FD_1000"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tc.pid)
+			t.Setenv("LISTEN_FDS", tc.fds)
+			t.Setenv("LISTEN_FDNAMES", tc.names)
+			_, err := systemdListeners(start)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want one mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateAddress(t *testing.T) {
+	for _, tc := range []struct {
+		addr string
+		ok   bool
+	}{
+		{":8080", true},
+		{"127.0.0.1:8080", true},
+		{"[::1]:8080", true},
+		{"unix:/run/exporter.sock", true},
+		{"unix:", false},
+		{"localhost", false},
+		{"127.0.0.1:8080:1", false},
+	} {
+		if err := ValidateAddress(tc.addr); (err == nil) != tc.ok {
+			t.Errorf("ValidateAddress(%q) = %v, want ok %v", tc.addr, err, tc.ok)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "exporter.sock")
+	listeners, err := Listen(ListenConfig{Addresses: []string{"127.0.0.1:0", "unix:" + sock}, UnixSocketMode: 0o640})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	if len(listeners) != 2 {
+		t.Fatalf("got %d listeners, want 2", len(listeners))
+	}
+	for _, l := range listeners {
+		conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		if err != nil {
+			t.Fatalf("dialing %s: %v", l.Addr(), err)
+		}
+		conn.Close()
+	}
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0o640 {
+		t.Errorf("socket mode = %v, want socket with 0640", fi.Mode())
+	}
+}
+
+func TestListenRemovesStaleSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "exporter.sock")
+	// 模拟异常退出：关闭 listener 但保留 socket 文件
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if _, err := os.Lstat(sock); err != nil {
+		t.Fatal(err)
+	}
+
+	listeners, err := Listen(ListenConfig{Addresses: []string{"unix:" + sock}})
+	if err != nil {
+		t.Fatalf("stale socket was not removed: %v", err)
+	}
+	listeners[0].Close()
+}
+
+func TestListenKeepsRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exporter.sock")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(ListenConfig{Addresses: []string{"unix:" + path}}); err == nil {
+		t.Fatal("listening on a regular file succeeded")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+		t.Errorf("regular file was changed: %q, %v", data, err)
+	}
+}
+
+func TestListenClosesOnError(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "exporter.sock")
+	_, err := Listen(ListenConfig{Addresses: []string{"unix:" + sock, "127.0.0.1:bad"}})
+	if err == nil {
+		t.Fatal("expected an error for an invalid port")
+	}
+	// 已打开的 unix socket 被关闭并删除
+	if _, err := os.Lstat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket of the closed listener still exists: %v", err)
+	}
+}
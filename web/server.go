@@ -0,0 +1,148 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ListenAndServe serves server.Handler on the listeners of lc, applying the
+// TLS and basic-auth settings of webConfigFile. An empty webConfigFile serves
+// plain HTTP without authentication. The health and readiness probes
+// /-/healthy and /-/ready never require basic auth.
+func ListenAndServe(server *http.Server, lc ListenConfig, webConfigFile string, logger *slog.Logger) error {
+	listeners, err := Listen(lc)
+	if err != nil {
+		return err
+	}
+	return Serve(listeners, server, webConfigFile, logger)
+}
+
+// Serve is like ListenAndServe on already opened listeners. It returns once
+// any of them stops serving, e.g. after server.Shutdown.
+func Serve(listeners []net.Listener, server *http.Server, webConfigFile string, logger *slog.Logger) error {
+	serve, err := configure(server, webConfigFile, logger)
+	if err != nil {
+		for _, l := range listeners {
+			l.Close()
+		}
+		return err
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		logger.Info("Listening on", "address", l.Addr().String(), "tls", server.TLSConfig != nil)
+		go func() {
+			errs <- serve(l)
+		}()
+	}
+	return <-errs
+}
+
+// configure 按 web 配置设置 server，返回在单个 listener 上服务的函数
+func configure(server *http.Server, webConfigFile string, logger *slog.Logger) (func(net.Listener) error, error) {
+	if webConfigFile == "" {
+		return server.Serve, nil
+	}
+
+	// 启动时先校验一次，之后每次握手和请求都重新读取配置文件，实现证书和用户热更新
+	cfg, err := LoadConfig(webConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	handler := server.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	server.Handler = &authHandler{webConfigFile: webConfigFile, handler: handler, logger: logger}
+	if !cfg.HTTPConfig.HTTP2 {
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	if !cfg.TLSConfig.Enabled() {
+		return server.Serve, nil
+	}
+	if _, err := cfg.TLSConfig.ServerConfig(); err != nil {
+		return nil, err
+	}
+	// GetConfigForClient 返回的配置会替换 server.TLSConfig，需要自己带上 ALPN 协议。
+	// http2 与 TLSNextProto 一样只在启动时读取
+	nextProtos := []string{"http/1.1"}
+	if cfg.HTTPConfig.HTTP2 {
+		nextProtos = []string{"h2", "http/1.1"}
+	}
+	server.TLSConfig = &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg, err := LoadConfig(webConfigFile)
+			if err != nil {
+				logger.Error("Error reloading web config", "err", err)
+				return nil, err
+			}
+			tc, err := cfg.TLSConfig.ServerConfig()
+			if err != nil {
+				return nil, err
+			}
+			tc.NextProtos = nextProtos
+			return tc, nil
+		},
+	}
+	return func(l net.Listener) error {
+		return server.ServeTLS(l, "", "")
+	}, nil
+}
+
+// probePaths 为存活和就绪探针，kubelet 等探针通常无法携带 basic auth，不做校验
+var probePaths = map[string]bool{"/-/healthy": true, "/-/ready": true}
+
+// authHandler 校验 basic_auth_users 中 bcrypt 加密的密码
+type authHandler struct {
+	webConfigFile string
+	handler       http.Handler
+	logger        *slog.Logger
+
+	// bcrypt 很慢，缓存校验通过的用户名、密码与哈希组合
+	cache sync.Map
+}
+
+// 用户不存在时也做一次 bcrypt 比较，避免通过响应时间探测用户名
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg, err := LoadConfig(h.webConfigFile)
+	if err != nil {
+		h.logger.Error("Error reloading web config", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	for k, v := range cfg.HTTPConfig.Headers {
+		w.Header().Set(k, v)
+	}
+	if len(cfg.BasicAuthUsers) == 0 || probePaths[r.URL.Path] {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if ok {
+		hash, found := cfg.BasicAuthUsers[user]
+		hashed := []byte(hash)
+		if !found {
+			hashed = dummyHash
+		}
+		key := sha256.Sum256([]byte(user + "\x00" + pass + "\x00" + hash))
+		_, cached := h.cache.Load(key)
+		authOK := cached || bcrypt.CompareHashAndPassword(hashed, []byte(pass)) == nil
+		if authOK && found {
+			h.cache.Store(key, struct{}{})
+			h.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="exporter"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,318 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testCA 签发测试用的服务端和客户端证书
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert, key, pool, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发证书，serial 用于区分轮换前后的证书
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writeServerCert 把证书和私钥写入 dir 下的 server.crt 和 server.key
+func writeServerCert(t *testing.T, dir string, cert tls.Certificate) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "server.crt"), string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})))
+	writeFile(t, filepath.Join(dir, "server.key"), string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve 按 dir 下的 web.yml 在随机端口上启动服务，返回地址
+func serve(t *testing.T, dir string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	server := &http.Server{Handler: mux}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := Serve([]net.Listener{l}, server, filepath.Join(dir, "web.yml"), slog.New(slog.NewTextHandler(io.Discard, nil))); err != http.ErrServerClosed {
+			t.Errorf("Serve: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		server.Close()
+		<-done
+	})
+	return l.Addr().String()
+}
+
+// client 每次新建连接，证书轮换后能看到新证书
+func client(tc *tls.Config) *http.Client {
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tc, DisableKeepAlives: true, ForceAttemptHTTP2: true}}
+}
+
+func hash(t *testing.T, password string) string {
+	t.Helper()
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(h)
+}
+
+func TestBasicAuth(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "web.yml"), `
+http_server_config:
+  headers:
+    X-Frame-Options: deny
+basic_auth_users:
+  alice: `+hash(t, "secret")+"\n")
+	addr := serve(t, dir)
+
+	get := func(path, user, pass string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+path, nil)
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	for _, tc := range []struct {
+		name, path, user, pass string
+		want                   int
+	}{
+		{"valid", "/metrics", "alice", "secret", http.StatusOK},
+		// 第二次命中缓存
+		{"valid cached", "/metrics", "alice", "secret", http.StatusOK},
+		{"wrong password", "/metrics", "alice", "wrong", http.StatusUnauthorized},
+		{"unknown user", "/metrics", "bob", "secret", http.StatusUnauthorized},
+		{"missing header", "/metrics", "", "", http.StatusUnauthorized},
+		{"health probe", "/-/healthy", "", "", http.StatusOK},
+		{"readiness probe", "/-/ready", "", "", http.StatusOK},
+	} {
+		resp := get(tc.path, tc.user, tc.pass)
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+		if got := resp.Header.Get("X-Frame-Options"); got != "deny" {
+			t.Errorf("%s: X-Frame-Options = %q", tc.name, got)
+		}
+		if tc.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: missing WWW-Authenticate", tc.name)
+		}
+	}
+
+	// 用户在下一次请求时重新读取，已缓存的密码也随之失效
+	writeFile(t, filepath.Join(dir, "web.yml"), "basic_auth_users:\n  bob: "+hash(t, "other")+"\n")
+	if resp := get("/metrics", "alice", "secret"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("removed user: status = %d, want 401", resp.StatusCode)
+	}
+	if resp := get("/metrics", "bob", "other"); resp.StatusCode != http.StatusOK {
+		t.Errorf("added user: status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestTLSCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	writeServerCert(t, dir, ca.issue(t, 10, x509.ExtKeyUsageServerAuth))
+	writeFile(t, filepath.Join(dir, "web.yml"), "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n")
+	addr := serve(t, dir)
+
+	serial := func() int64 {
+		t.Helper()
+		resp, err := client(&tls.Config{RootCAs: ca.pool}).Get("https://" + addr + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+	if got := serial(); got != 10 {
+		t.Fatalf("serial = %d, want 10", got)
+	}
+	// 替换证书文件后，新的握手使用新证书
+	writeServerCert(t, dir, ca.issue(t, 11, x509.ExtKeyUsageServerAuth))
+	if got := serial(); got != 11 {
+		t.Errorf("serial after rotation = %d, want 11", got)
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	writeServerCert(t, dir, ca.issue(t, 10, x509.ExtKeyUsageServerAuth))
+	writeFile(t, filepath.Join(dir, "web.yml"), `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+  min_version: TLS13
+`)
+	addr := serve(t, dir)
+
+	if _, err := client(&tls.Config{RootCAs: ca.pool, MaxVersion: tls.VersionTLS12}).Get("https://" + addr); err == nil {
+		t.Error("TLS 1.2 handshake succeeded with min_version TLS13")
+	}
+	resp, err := client(&tls.Config{RootCAs: ca.pool}).Get("https://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("negotiated version %x, want TLS 1.3", resp.TLS.Version)
+	}
+}
+
+func TestTLSClientCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	writeServerCert(t, dir, ca.issue(t, 10, x509.ExtKeyUsageServerAuth))
+	writeFile(t, filepath.Join(dir, "ca.crt"), string(ca.pem))
+	writeFile(t, filepath.Join(dir, "web.yml"), `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+  client_ca_file: ca.crt
+  client_auth_type: RequireAndVerifyClientCert
+`)
+	addr := serve(t, dir)
+
+	if resp, err := client(&tls.Config{RootCAs: ca.pool}).Get("https://" + addr); err == nil {
+		resp.Body.Close()
+		t.Error("request without a client certificate succeeded")
+	}
+	// 其他 CA 签发的客户端证书同样被拒绝
+	other := newTestCA(t).issue(t, 20, x509.ExtKeyUsageClientAuth)
+	if resp, err := client(&tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{other}}).Get("https://" + addr); err == nil {
+		resp.Body.Close()
+		t.Error("request with an untrusted client certificate succeeded")
+	}
+	cert := ca.issue(t, 21, x509.ExtKeyUsageClientAuth)
+	resp, err := client(&tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{cert}}).Get("https://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestTLSHTTP2(t *testing.T) {
+	for _, tc := range []struct {
+		http2 string
+		want  string
+	}{
+		{"true", "h2"},
+		{"false", "http/1.1"},
+	} {
+		t.Run("http2="+tc.http2, func(t *testing.T) {
+			dir := t.TempDir()
+			ca := newTestCA(t)
+			writeServerCert(t, dir, ca.issue(t, 10, x509.ExtKeyUsageServerAuth))
+			writeFile(t, filepath.Join(dir, "web.yml"), `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+http_server_config:
+  http2: `+tc.http2+"\n")
+			addr := serve(t, dir)
+
+			resp, err := client(&tls.Config{RootCAs: ca.pool}).Get("https://" + addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got := resp.TLS.NegotiatedProtocol; got != tc.want {
+				t.Errorf("ALPN protocol = %q, want %q", got, tc.want)
+			}
+			if want := map[string]int{"h2": 2, "http/1.1": 1}[tc.want]; resp.ProtoMajor != want {
+				t.Errorf("served over %s", resp.Proto)
+			}
+		})
+	}
+}